@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+const (
+	refreshTokenPrefixLen = 8
+	maxBulkUpgradeUsers   = 1000
+)
+
+// requireAdmin checks the X-Admin-Key header against ADMIN_KEY and writes
+// the error response when it doesn't match. Admin endpoints are for
+// operators in any environment, unlike the dev-only reset.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.adminKey == "" {
+		respondWithError(w, http.StatusServiceUnavailable, "Admin endpoints are not configured")
+		return false
+	}
+	key := r.Header.Get("X-Admin-Key")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminKey)) != 1 {
+		respondWithError(w, http.StatusUnauthorized, "Missing or wrong admin key")
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerListRefreshTokens(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+	query := r.URL.Query()
+
+	params := database.ListRefreshTokensParams{State: "all"}
+	if userID := query.Get("user_id"); userID != "" {
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error bad user id: %v", err))
+			return
+		}
+		params.UserID = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+	if state := query.Get("state"); state != "" {
+		switch state {
+		case "all", "active", "revoked", "expired":
+			params.State = state
+		default:
+			respondWithError(w, http.StatusBadRequest, "state must be one of all, active, revoked, expired")
+			return
+		}
+	}
+	limit, offset, err := parsePagination(r, 50, 100)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.RowLimit = limit
+	params.RowOffset = offset
+
+	tokens, err := cfg.queries.ListRefreshTokens(r.Context(), params)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't list refresh tokens: %w", err))
+		return
+	}
+
+	type refreshToken struct {
+		TokenPrefix string     `json:"token_prefix"`
+		UserID      uuid.UUID  `json:"user_id"`
+		CreatedAt   time.Time  `json:"created_at"`
+		ExpiresAt   time.Time  `json:"expires_at"`
+		RevokedAt   *time.Time `json:"revoked_at"`
+	}
+	res := make([]refreshToken, 0, len(tokens))
+	for _, token := range tokens {
+		rt := refreshToken{
+			TokenPrefix: token.Token[:min(refreshTokenPrefixLen, len(token.Token))],
+			UserID:      token.UserID,
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+		}
+		if token.RevokedAt.Valid {
+			rt.RevokedAt = &token.RevokedAt.Time
+		}
+		res = append(res, rt)
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		RefreshTokens []refreshToken `json:"refresh_tokens"`
+		Limit         int32          `json:"limit"`
+		Offset        int32          `json:"offset"`
+	}{res, limit, offset})
+}
+
+func (cfg *apiConfig) handlerBulkUpgradeUsers(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+	reqBody := struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Couldn't decode parameters: %s", err))
+		return
+	}
+	if len(reqBody.UserIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "user_ids must not be empty")
+		return
+	}
+	if len(reqBody.UserIDs) > maxBulkUpgradeUsers {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("at most %d user_ids per request", maxBulkUpgradeUsers))
+		return
+	}
+
+	upgraded, err := cfg.queries.UpgradeUsers(r.Context(), reqBody.UserIDs)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't upgrade users: %w", err))
+		return
+	}
+	found := make(map[uuid.UUID]struct{}, len(upgraded))
+	for _, id := range upgraded {
+		found[id] = struct{}{}
+		cfg.audit(r, uuid.Nil, auditChirpyRedUpgrade, id)
+	}
+	notFound := make([]uuid.UUID, 0)
+	for _, id := range reqBody.UserIDs {
+		if _, ok := found[id]; !ok {
+			notFound = append(notFound, id)
+			found[id] = struct{}{}
+		}
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		Upgraded int         `json:"upgraded"`
+		NotFound []uuid.UUID `json:"not_found"`
+	}{len(upgraded), notFound})
+}
+
+// handlerRevokeUserSessions revokes every outstanding refresh token for a
+// user. Access tokens already issued stay valid until they expire.
+func (cfg *apiConfig) handlerRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+	uid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error bad user id: %v", err))
+		return
+	}
+	if _, err := cfg.queries.GetUserByID(r.Context(), uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		respondInternal(w, r, fmt.Errorf("couldn't get user: %w", err))
+		return
+	}
+	revoked, err := cfg.queries.RevokeAllRefreshTokensForUser(r.Context(), uid)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't revoke sessions: %w", err))
+		return
+	}
+	cfg.audit(r, uuid.Nil, auditSessionsRevoke, uid)
+	respondWithJSON(w, http.StatusOK, struct {
+		Revoked int64 `json:"revoked"`
+	}{revoked})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminEndpointsRequireAdminKey(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+
+	handlers := []struct {
+		name    string
+		method  string
+		pattern string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"List refresh tokens", http.MethodGet, "GET /admin/refresh-tokens", "/admin/refresh-tokens", cfg.handlerListRefreshTokens},
+		{"Bulk upgrade", http.MethodPost, "POST /admin/users/upgrade", "/admin/users/upgrade", cfg.handlerBulkUpgradeUsers},
+		{"Revoke sessions", http.MethodPost, "POST /admin/users/{userID}/revoke-sessions", "/admin/users/" + userID.String() + "/revoke-sessions", cfg.handlerRevokeUserSessions},
+		{"Audit log", http.MethodGet, "GET /admin/audit-log", "/admin/audit-log", cfg.handlerListAuditLog},
+		{"List feature flags", http.MethodGet, "GET /admin/feature-flags", "/admin/feature-flags", cfg.handlerListFeatureFlags},
+		{"Set feature flag", http.MethodPut, "PUT /admin/feature-flags/{name}", "/admin/feature-flags/quotes", cfg.handlerSetFeatureFlag},
+		{"Health detail", http.MethodGet, "GET /admin/health/detail", "/admin/health/detail", cfg.handlerHealthDetail},
+	}
+	tests := []struct {
+		name       string
+		adminKey   string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "Not configured",
+			header:     "anything",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "Missing key",
+			adminKey:   "admin-secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Wrong key",
+			adminKey:   "admin-secret",
+			header:     "admin-secreT",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, h := range handlers {
+			t.Run(tt.name+"/"+h.name, func(t *testing.T) {
+				cfg.adminKey = tt.adminKey
+				cfg.platform = "dev"
+				mux := http.NewServeMux()
+				mux.Handle(h.pattern, h.handler)
+				req := httptest.NewRequest(h.method, h.path, nil)
+				if tt.header != "" {
+					req.Header.Set("X-Admin-Key", tt.header)
+				}
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+				if rec.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+			})
+		}
+	}
+
+	t.Run("Correct key outside dev", func(t *testing.T) {
+		cfg.adminKey = "admin-secret"
+		cfg.platform = ""
+		store.seedRefreshToken(userID)
+		req := httptest.NewRequest(http.MethodPost, "/admin/users/"+userID.String()+"/revoke-sessions", nil)
+		req.SetPathValue("userID", userID.String())
+		req.Header.Set("X-Admin-Key", "admin-secret")
+		rec := httptest.NewRecorder()
+		cfg.handlerRevokeUserSessions(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestListAuditLog(t *testing.T) {
+	cfg, _ := newChirpStoreConfig(t)
+	cfg.adminKey = "admin-secret"
+	alice, bob := uuid.New(), uuid.New()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	cfg.audit(req, alice, auditLogin, alice)
+	cfg.audit(req, bob, auditLogin, bob)
+	cfg.audit(req, alice, auditPasswordChange, alice)
+	cfg.audit(req, uuid.Nil, auditChirpyRedUpgrade, bob)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantActions []string
+	}{
+		{
+			name:        "No filters",
+			wantStatus:  http.StatusOK,
+			wantActions: []string{auditChirpyRedUpgrade, auditPasswordChange, auditLogin, auditLogin},
+		},
+		{
+			name:        "By actor",
+			query:       "?actor_id=" + alice.String(),
+			wantStatus:  http.StatusOK,
+			wantActions: []string{auditPasswordChange, auditLogin},
+		},
+		{
+			name:        "By action",
+			query:       "?action=" + auditLogin,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{auditLogin, auditLogin},
+		},
+		{
+			name:        "By actor and action",
+			query:       "?actor_id=" + bob.String() + "&action=" + auditLogin,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{auditLogin},
+		},
+		{
+			name:        "Paginated",
+			query:       "?limit=2&offset=1",
+			wantStatus:  http.StatusOK,
+			wantActions: []string{auditPasswordChange, auditLogin},
+		},
+		{
+			name:        "No matches",
+			query:       "?action=" + auditAccountDelete,
+			wantStatus:  http.StatusOK,
+			wantActions: []string{},
+		},
+		{
+			name:       "Bad actor id",
+			query:      "?actor_id=alice",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/audit-log"+tt.query, nil)
+			req.Header.Set("X-Admin-Key", cfg.adminKey)
+			rec := httptest.NewRecorder()
+			cfg.handlerListAuditLog(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var res struct {
+				Entries []struct {
+					Action string `json:"action"`
+				} `json:"entries"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatalf("couldn't decode response: %v", err)
+			}
+			got := make([]string, 0, len(res.Entries))
+			for _, e := range res.Entries {
+				got = append(got, e.Action)
+			}
+			if !slices.Equal(got, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", got, tt.wantActions)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/auth"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+var (
+	errUserGone        = errors.New("user no longer exists")
+	errUserDeactivated = errors.New("account is deactivated")
+)
+
+const userCacheKey contextKey = "user"
+
+// userCache holds the authenticated user's row for the lifetime of one
+// request so repeated checks don't each query for it.
+type userCache struct {
+	loaded bool
+	id     uuid.UUID
+	user   database.User
+	err    error
+}
+
+// middlewareUserCache gives every request an empty userCache.
+func middlewareUserCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), userCacheKey, &userCache{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// userFromContext returns the user already loaded during this request, if
+// any.
+func userFromContext(r *http.Request) (database.User, bool) {
+	cache, ok := r.Context().Value(userCacheKey).(*userCache)
+	if !ok || !cache.loaded || cache.err != nil {
+		return database.User{}, false
+	}
+	return cache.user, true
+}
+
+// loadUser returns the user with the given ID, querying at most once per
+// request for the authenticated user. Handlers that need the caller's row
+// should use userFromContext, falling back to loadUser, rather than
+// GetUserByID so they share the lookup already made by authenticateUser.
+func (cfg *apiConfig) loadUser(r *http.Request, id uuid.UUID) (database.User, error) {
+	cache, ok := r.Context().Value(userCacheKey).(*userCache)
+	if !ok {
+		return cfg.queries.GetUserByID(r.Context(), id)
+	}
+	if !cache.loaded || cache.id != id {
+		cache.user, cache.err = cfg.queries.GetUserByID(r.Context(), id)
+		cache.id = id
+		cache.loaded = true
+	}
+	return cache.user, cache.err
+}
+
+// authError is an authentication failure that should be reported to the
+// client as a 401, as opposed to a server-side failure while checking.
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string { return e.err.Error() }
+func (e *authError) Unwrap() error { return e.err }
+
+// authenticateUser returns the ID of the user whose access token is on r.
+// With checkUserExists set, the default, it also loads the user through the
+// request cache, so tokens of deleted users are rejected up front instead
+// of failing later on a foreign key, and deactivated users can't keep
+// acting with a token issued before they deactivated. That costs a query
+// per request; AUTH_CHECK_USER_EXISTS=false skips it, and such tokens then
+// work until they expire.
+func (cfg *apiConfig) authenticateUser(r *http.Request) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, &authError{fmt.Errorf("Access token not found: %w", err)}
+	}
+	userid, err := auth.ValidateJWT(token, cfg.secret, cfg.jwtLeeway)
+	if err != nil {
+		return uuid.Nil, &authError{fmt.Errorf("Invalid token: %w", err)}
+	}
+	if !cfg.checkUserExists {
+		return userid, nil
+	}
+	usr, err := cfg.loadUser(r, userid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, &authError{errUserGone}
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("couldn't get user: %w", err)
+	}
+	if !usr.IsActive {
+		return uuid.Nil, &authError{errUserDeactivated}
+	}
+	return userid, nil
+}
+
+// optionalAuth returns the authenticated user's ID on public endpoints that
+// personalize their response. A missing or invalid token is not an error:
+// the caller just gets an invalid NullUUID and serves the anonymous view.
+func (cfg *apiConfig) optionalAuth(r *http.Request) uuid.NullUUID {
+	userid, err := cfg.authenticateUser(r)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userid, Valid: true}
+}
+
+// respondAuthError writes the response for an error from authenticateUser.
+// A deactivated account gets a 403, like a refresh attempt for one.
+func respondAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errUserDeactivated) {
+		respondWithError(w, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+	var ae *authError
+	if errors.As(err, &ae) {
+		respondWithError(w, http.StatusUnauthorized, ae.Error())
+		return
+	}
+	respondInternal(w, r, err)
+}
+
+// makeAccessToken issues an access token for usr. The chirpy_red claim is a
+// snapshot for clients; the server still checks the user row.
+func (cfg *apiConfig) makeAccessToken(usr database.User) (string, error) {
+	claims := auth.NewClaims(usr.ID, cfg.jwtExpiry)
+	claims.IsChirpyRed = usr.IsChirpyRed
+	return auth.SignClaims(claims, cfg.secret)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/auth"
+)
+
+func TestAuthenticateUser(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+	valid, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+	wrongSecret, _ := auth.MakeJWT(userID, "other", time.Hour)
+	inactiveID := store.seedUser("inactive@example.com")
+	store.users[inactiveID.String()][6] = false
+	inactive, _ := auth.MakeJWT(inactiveID, cfg.secret, time.Hour)
+	deleted, _ := auth.MakeJWT(uuid.New(), cfg.secret, time.Hour)
+
+	tests := []struct {
+		name          string
+		authorization string
+		skipCheck     bool
+		wantUserID    uuid.UUID
+		wantStatus    int
+	}{
+		{
+			name:          "Valid token",
+			authorization: "Bearer " + valid,
+			wantUserID:    userID,
+		},
+		{
+			name:       "Missing header",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong secret",
+			authorization: "Bearer " + wrongSecret,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Deactivated user",
+			authorization: "Bearer " + inactive,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "Deleted user",
+			authorization: "Bearer " + deleted,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Deactivated user without the check",
+			authorization: "Bearer " + inactive,
+			skipCheck:     true,
+			wantUserID:    inactiveID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.checkUserExists = !tt.skipCheck
+			queried := store.queried["GetUserByID"]
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			got, err := cfg.authenticateUser(req)
+			if tt.skipCheck && store.queried["GetUserByID"] != queried {
+				t.Errorf("authenticateUser() queried the user with the check disabled")
+			}
+			if tt.wantStatus == 0 {
+				if err != nil || got != tt.wantUserID {
+					t.Fatalf("authenticateUser() = %v, %v, want %v", got, err, tt.wantUserID)
+				}
+				return
+			}
+			rec := httptest.NewRecorder()
+			respondAuthError(rec, req, err)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+	valid, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          uuid.NullUUID
+	}{
+		{
+			name:          "Valid token",
+			authorization: "Bearer " + valid,
+			want:          uuid.NullUUID{UUID: userID, Valid: true},
+		},
+		{
+			name: "Anonymous",
+			want: uuid.NullUUID{},
+		},
+		{
+			name:          "Invalid token",
+			authorization: "Bearer garbage",
+			want:          uuid.NullUUID{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if got := cfg.optionalAuth(req); got != tt.want {
+				t.Errorf("optionalAuth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRespondAuthErrorServerFailure(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondAuthError(rec, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("connection refused"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestAuthenticatedUserIsQueriedOnce(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+	token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+	handler := middlewareUserCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := cfg.authenticateUser(r)
+		if err != nil {
+			t.Fatalf("authenticateUser() error = %v", err)
+		}
+		if _, err := cfg.loadUser(r, id); err != nil {
+			t.Fatalf("loadUser() error = %v", err)
+		}
+		if usr, ok := userFromContext(r); !ok || usr.ID != userID {
+			t.Errorf("userFromContext() = %v, %v, want user %v", usr.ID, ok, userID)
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := store.queried["GetUserByID"]; n != 1 {
+		t.Errorf("GetUserByID queries = %d, want 1", n)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+type Chirp struct {
+	database.Chirp
+	PublishAt   *time.Time     `json:"publish_at,omitempty"`
+	QuotedChirp *QuotedChirp   `json:"quoted_chirp,omitempty"`
+	Entities    *ChirpEntities `json:"entities,omitempty"`
+	Author      *ChirpAuthor   `json:"author,omitempty"`
+	// Truncated is set on creation when TRUNCATE_LONG_CHIRPS shortened the
+	// body instead of rejecting it.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// maxChirpLength is the longest chirp body allowed, in runes.
+const maxChirpLength = 140
+
+// truncateAtWord shortens body to at most max runes, cutting at the last
+// space if there is one so words aren't split.
+func truncateAtWord(body string, max int) string {
+	runes := []rune(body)
+	if len(runes) <= max {
+		return body
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \t\n")
+}
+
+var errChirpTooLong = errors.New("Chirp is too long")
+
+// fitChirpLength sanitizes body when SANITIZE_CHIRPS is set and enforces
+// maxChirpLength on the result, truncating it instead of failing when
+// TRUNCATE_LONG_CHIRPS is set. The limit applies to the sanitized text
+// because escaping angle brackets makes it longer. It reports whether body
+// was truncated.
+func (cfg *apiConfig) fitChirpLength(body string) (string, bool, error) {
+	if cfg.sanitizeChirps {
+		body = sanitizeBody(body)
+	}
+	if utf8.RuneCountInString(body) <= maxChirpLength {
+		return body, false, nil
+	}
+	if !cfg.truncateLongChirps {
+		return "", false, errChirpTooLong
+	}
+	cut := truncateAtWord(body, maxChirpLength)
+	if cfg.sanitizeChirps {
+		cut = trimPartialEntity(cut)
+	}
+	return cut, true, nil
+}
+
+// trimPartialEntity drops an escaped angle bracket that truncation cut in
+// half, so a sanitized body never ends in a stray "&l" or "&gt".
+func trimPartialEntity(body string) string {
+	for _, entity := range []string{"&lt;", "&gt;"} {
+		for n := len(entity) - 1; n > 1; n-- {
+			if strings.HasSuffix(body, entity[:n]) {
+				return strings.TrimRight(strings.TrimSuffix(body, entity[:n]), " \t\n")
+			}
+		}
+	}
+	return body
+}
+
+// cleanChirpBody applies the profanity policy to a body that has been
+// through fitChirpLength, masking banned words or, in reject mode, writing
+// a 400 listing them and returning false.
+func (cfg *apiConfig) cleanChirpBody(w http.ResponseWriter, body string) (string, bool) {
+	cleaned, bad := cfg.cleanChirpText(body)
+	if len(bad) > 0 {
+		respondWithJSON(w, http.StatusBadRequest, struct {
+			Error string   `json:"error"`
+			Words []string `json:"words"`
+		}{"Chirp contains banned words", bad})
+		return "", false
+	}
+	return cleaned, true
+}
+
+// cleanChirpText is cleanChirpBody without the response: in reject mode it
+// returns the banned words found instead of a cleaned body.
+func (cfg *apiConfig) cleanChirpText(body string) (string, []string) {
+	if cfg.profanityMode == "reject" {
+		normalize := strings.ToLower
+		if cfg.normalizeProfanity {
+			normalize = normalizeWord
+		}
+		if bad := detectBadWords(body, cfg.profaneWords, normalize); len(bad) > 0 {
+			return "", bad
+		}
+	}
+	if cfg.normalizeProfanity {
+		return cleanBodyNormalized(body, cfg.profaneWords), nil
+	}
+	return cleanBody(body, cfg.profaneWords), nil
+}
+
+// prepareWelcomeChirp puts the WELCOME_CHIRP template through the same
+// length and profanity rules as any other chirp, once at startup. It is
+// posted verbatim, so it can't reveal anything about the new user.
+func (cfg *apiConfig) prepareWelcomeChirp() error {
+	if cfg.welcomeChirp == "" {
+		return nil
+	}
+	body, _, err := cfg.fitChirpLength(cfg.welcomeChirp)
+	if err != nil {
+		return err
+	}
+	body, bad := cfg.cleanChirpText(body)
+	if len(bad) > 0 {
+		return fmt.Errorf("contains banned words %q", bad)
+	}
+	cfg.welcomeChirp = body
+	return nil
+}
+
+// ChirpAuthor is the public view of a chirp's author embedded with
+// ?expand=author. Email addresses are deliberately left out.
+type ChirpAuthor struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+// maxUsersPerQuery caps how many IDs go into a single GetUsersByIDs call.
+const maxUsersPerQuery = 100
+
+// ChirpEntities is metadata computed from a chirp's body so clients don't
+// have to re-parse it. Entity ranges are byte offsets into the body.
+type ChirpEntities struct {
+	Length   int      `json:"length"`
+	URLs     []Entity `json:"urls"`
+	Hashtags []Entity `json:"hashtags"`
+	Mentions []Entity `json:"mentions"`
+}
+
+type Entity struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+var (
+	urlPattern     = regexp.MustCompile(`https?://[^\s]+[^\s.,!?;:)]`)
+	hashtagPattern = regexp.MustCompile(`(?:^|\s)(#[\p{L}\p{N}_]+)`)
+	mentionPattern = regexp.MustCompile(`(?:^|\s)(@[\p{L}\p{N}_]+)`)
+)
+
+func extractEntities(body string) *ChirpEntities {
+	return &ChirpEntities{
+		Length:   utf8.RuneCountInString(body),
+		URLs:     findEntities(body, urlPattern, 0),
+		Hashtags: findEntities(body, hashtagPattern, 1),
+		Mentions: findEntities(body, mentionPattern, 1),
+	}
+}
+
+// findEntities returns the ranges matched by group of pattern in body.
+func findEntities(body string, pattern *regexp.Regexp, group int) []Entity {
+	entities := make([]Entity, 0)
+	for _, m := range pattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := m[2*group], m[2*group+1]
+		entities = append(entities, Entity{Text: body[start:end], Start: start, End: end})
+	}
+	return entities
+}
+
+// QuotedChirp is the embedded view of a quoted chirp. When the quoted chirp
+// no longer exists only its ID is kept and Deleted is set.
+type QuotedChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Body      string     `json:"body"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+}
+
+const deletedChirpPlaceholder = "This chirp is no longer available"
+
+func newChirp(chirp database.Chirp) Chirp {
+	c := Chirp{Chirp: chirp}
+	if chirp.PublishAt.Valid {
+		c.PublishAt = &chirp.PublishAt.Time
+	}
+	return c
+}
+
+// isPublished reports whether chirp is publicly visible, i.e. it isn't
+// scheduled for a future time.
+func isPublished(chirp database.Chirp) bool {
+	return !chirp.PublishAt.Valid || !chirp.PublishAt.Time.After(time.Now())
+}
+
+// chirpResponses converts database chirps to their API representation,
+// resolving all quoted chirps with a single query.
+func (cfg *apiConfig) chirpResponses(ctx context.Context, chirps []database.Chirp) ([]Chirp, error) {
+	quotedIDs := make([]uuid.UUID, 0)
+	for _, chirp := range chirps {
+		if chirp.QuotedChirpID.Valid {
+			quotedIDs = append(quotedIDs, chirp.QuotedChirpID.UUID)
+		}
+	}
+	quoted := make(map[uuid.UUID]database.Chirp, len(quotedIDs))
+	if len(quotedIDs) > 0 {
+		rows, err := cfg.readQueries.GetChirpsByIDs(ctx, quotedIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if isPublished(row) {
+				quoted[row.ID] = row
+			}
+		}
+	}
+
+	res := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		c := newChirp(chirp)
+		if chirp.QuotedChirpID.Valid {
+			id := chirp.QuotedChirpID.UUID
+			if q, ok := quoted[id]; ok {
+				c.QuotedChirp = &QuotedChirp{
+					ID:        q.ID,
+					CreatedAt: &q.CreatedAt,
+					Body:      q.Body,
+					UserID:    &q.UserID,
+				}
+			} else {
+				c.QuotedChirp = &QuotedChirp{
+					ID:      id,
+					Body:    deletedChirpPlaceholder,
+					Deleted: true,
+				}
+			}
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// expandAuthors embeds each chirp's author, looking up all distinct authors
+// in batches rather than one query per chirp.
+func (cfg *apiConfig) expandAuthors(ctx context.Context, chirps []Chirp) error {
+	seen := make(map[uuid.UUID]struct{})
+	ids := make([]uuid.UUID, 0)
+	for _, chirp := range chirps {
+		if _, ok := seen[chirp.UserID]; !ok {
+			seen[chirp.UserID] = struct{}{}
+			ids = append(ids, chirp.UserID)
+		}
+	}
+	authors := make(map[uuid.UUID]*ChirpAuthor, len(ids))
+	for start := 0; start < len(ids); start += maxUsersPerQuery {
+		users, err := cfg.readQueries.GetUsersByIDs(ctx, ids[start:min(start+maxUsersPerQuery, len(ids))])
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			authors[u.ID] = &ChirpAuthor{ID: u.ID, CreatedAt: u.CreatedAt, IsChirpyRed: u.IsChirpyRed}
+		}
+	}
+	for i := range chirps {
+		chirps[i].Author = authors[chirps[i].UserID]
+	}
+	return nil
+}
+
+// decorateChirps builds the response every chirp endpoint returns for
+// chirps: quoted chirps resolved, entities added for ?entities=true,
+// authors embedded for ?expand=author, and each chirp projected onto
+// fields.
+func (cfg *apiConfig) decorateChirps(r *http.Request, chirps []database.Chirp, fields map[string]struct{}) ([]any, error) {
+	res, err := cfg.chirpResponses(r.Context(), chirps)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load quoted chirps: %w", err)
+	}
+	if r.URL.Query().Get("entities") == "true" {
+		for i := range res {
+			res[i].Entities = extractEntities(res[i].Body)
+		}
+	}
+	if wantsExpand(r, "author") {
+		if err := cfg.expandAuthors(r.Context(), res); err != nil {
+			return nil, fmt.Errorf("couldn't load authors: %w", err)
+		}
+	}
+	projected := make([]any, len(res))
+	for i, chirp := range res {
+		projected[i], err = projectChirp(chirp, fields)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't project chirps: %w", err)
+		}
+	}
+	return projected, nil
+}
+
+func (cfg *apiConfig) chirpResponse(ctx context.Context, chirp database.Chirp) (Chirp, error) {
+	res, err := cfg.chirpResponses(ctx, []database.Chirp{chirp})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return res[0], nil
+}
+
+var (
+	htmlTagPattern   = regexp.MustCompile(`</?[a-zA-Z!][^<>]*>`)
+	angleBracketsEsc = strings.NewReplacer("<", "&lt;", ">", "&gt;")
+)
+
+// sanitizeBody strips HTML tags from a chirp body, keeping the text between
+// them. Entities are decoded first so encoded tags can't slip through, and
+// any leftover angle brackets are escaped.
+func sanitizeBody(body string) string {
+	s := html.UnescapeString(body)
+	for {
+		stripped := htmlTagPattern.ReplaceAllString(s, "")
+		if stripped == s {
+			break
+		}
+		s = stripped
+	}
+	return angleBracketsEsc.Replace(s)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+func TestSanitizeBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "Plain text",
+			body: "just a chirp",
+			want: "just a chirp",
+		},
+		{
+			name: "Script tag",
+			body: "<script>alert('xss')</script>hello",
+			want: "alert('xss')hello",
+		},
+		{
+			name: "Tag with attributes",
+			body: `<img src=x onerror="alert(1)">nice pic`,
+			want: "nice pic",
+		},
+		{
+			name: "Entity-encoded script",
+			body: "&lt;script&gt;alert(1)&lt;/script&gt;",
+			want: "alert(1)",
+		},
+		{
+			name: "Nested tags",
+			body: "<<script>script>alert(1)<</script>/script>",
+			want: "alert(1)",
+		},
+		{
+			name: "Stray angle brackets",
+			body: "1 < 2 and 3 > 2",
+			want: "1 &lt; 2 and 3 &gt; 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeBody(tt.body); got != tt.want {
+				t.Errorf("sanitizeBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateAtWord(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		max  int
+		want string
+	}{
+		{
+			name: "Short enough",
+			body: "hello world",
+			max:  20,
+			want: "hello world",
+		},
+		{
+			name: "Cut at word boundary",
+			body: "hello wonderful world",
+			max:  12,
+			want: "hello",
+		},
+		{
+			name: "Single long word",
+			body: "supercalifragilistic",
+			max:  5,
+			want: "super",
+		},
+		{
+			name: "Multi-byte runes",
+			body: "héllo wörld ünïcode",
+			max:  13,
+			want: "héllo wörld",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateAtWord(tt.body, tt.max)
+			if got != tt.want {
+				t.Errorf("truncateAtWord() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChirpResponsesHidesDeactivatedQuotes(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	active := store.seedUser("active@example.com")
+	inactive := store.seedUser("inactive@example.com")
+	store.users[inactive.String()][6] = false
+	now := time.Now()
+	fromActive := store.seed(active, "still here", now)
+	fromInactive := store.seed(inactive, "gone quiet", now)
+
+	tests := []struct {
+		name        string
+		quoted      uuid.UUID
+		wantBody    string
+		wantDeleted bool
+	}{
+		{
+			name:     "Active author",
+			quoted:   fromActive,
+			wantBody: "still here",
+		},
+		{
+			name:        "Deactivated author",
+			quoted:      fromInactive,
+			wantBody:    deletedChirpPlaceholder,
+			wantDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chirp := database.Chirp{
+				ID:            uuid.New(),
+				Body:          "quoting",
+				UserID:        active,
+				QuotedChirpID: uuid.NullUUID{UUID: tt.quoted, Valid: true},
+			}
+			res, err := cfg.chirpResponses(context.Background(), []database.Chirp{chirp})
+			if err != nil {
+				t.Fatalf("chirpResponses() error = %v", err)
+			}
+			got := res[0].QuotedChirp
+			if got == nil || got.Body != tt.wantBody || got.Deleted != tt.wantDeleted {
+				t.Errorf("QuotedChirp = %+v, want body %q, deleted %v", got, tt.wantBody, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestPrepareWelcomeChirp(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		mode     string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Plain template",
+			template: "Hello, I just joined Chirpy!",
+			want:     "Hello, I just joined Chirpy!",
+		},
+		{
+			name:     "Profanity is masked",
+			template: "What a kerfuffle I joined Chirpy",
+			want:     "What a **** I joined Chirpy",
+		},
+		{
+			name:     "Profanity is rejected in reject mode",
+			template: "What a kerfuffle",
+			mode:     "reject",
+			wantErr:  true,
+		},
+		{
+			name:     "Too long",
+			template: strings.Repeat("a", maxChirpLength+1),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{welcomeChirp: tt.template, profanityMode: tt.mode, profaneWords: defaultProfaneWords}
+			err := cfg.prepareWelcomeChirp()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareWelcomeChirp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.welcomeChirp != tt.want {
+				t.Errorf("welcomeChirp = %q, want %q", cfg.welcomeChirp, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitChirpLengthSanitized(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		truncate bool
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "Escaped body within the limit",
+			body: "1 < 2",
+			want: "1 &lt; 2",
+		},
+		{
+			name:    "Angle brackets grow past the limit",
+			body:    strings.Repeat("<", maxChirpLength),
+			wantErr: true,
+		},
+		{
+			name:     "Truncated after escaping",
+			body:     strings.Repeat("<", maxChirpLength),
+			truncate: true,
+			want:     strings.Repeat("&lt;", maxChirpLength/4),
+		},
+		{
+			name:     "Truncation doesn't split an entity",
+			body:     "x" + strings.Repeat(">", maxChirpLength),
+			truncate: true,
+			want:     "x" + strings.Repeat("&gt;", (maxChirpLength-1)/4),
+		},
+		{
+			name: "Tags stripped before measuring",
+			body: "<b>" + strings.Repeat("a", maxChirpLength) + "</b>",
+			want: strings.Repeat("a", maxChirpLength),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{sanitizeChirps: true, truncateLongChirps: tt.truncate}
+			got, _, err := cfg.fitChirpLength(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fitChirpLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("fitChirpLength() = %q, want %q", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > maxChirpLength {
+				t.Errorf("fitChirpLength() returned %d runes, want at most %d", n, maxChirpLength)
+			}
+		})
+	}
+}
+
+func TestChirpResponsesReadQuotesFromReplica(t *testing.T) {
+	cfg, primary := newChirpStoreConfig(t)
+	replicaCfg, replica := newChirpStoreConfig(t)
+	cfg.readQueries = replicaCfg.queries
+	primary.failQuery = "GetChirpsByIDs"
+	author := replica.seedUser("user@example.com")
+	quoted := replica.seed(author, "original thought", time.Now())
+
+	chirp := database.Chirp{
+		ID:            uuid.New(),
+		Body:          "so true",
+		UserID:        author,
+		QuotedChirpID: uuid.NullUUID{UUID: quoted, Valid: true},
+	}
+	res, err := cfg.chirpResponses(context.Background(), []database.Chirp{chirp})
+	if err != nil {
+		t.Fatalf("chirpResponses() error = %v", err)
+	}
+	if got := res[0].QuotedChirp; got == nil || got.Body != "original thought" {
+		t.Errorf("QuotedChirp = %+v, want the replica's copy", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// middlewareConcurrencyLimit lets at most limit requests run at once. A
+// request that finds every slot busy waits up to maxWait for one to free up
+// and is otherwise shed with a 503. A limit of zero or less disables it.
+func middlewareConcurrencyLimit(limit int, maxWait time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		slots := make(chan struct{}, limit)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				timer := time.NewTimer(maxWait)
+				defer timer.Stop()
+				select {
+				case slots <- struct{}{}:
+				case <-timer.C:
+					w.Header().Set("Retry-After", "1")
+					respondWithError(w, http.StatusServiceUnavailable, "Server is busy, try again shortly")
+					return
+				case <-r.Context().Done():
+					return
+				}
+			}
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
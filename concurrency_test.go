@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimitSheds(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := middlewareConcurrencyLimit(1, 10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("saturated status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("saturated response is missing Retry-After")
+	}
+
+	close(release)
+	<-done
+	go func() { <-started }()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status after release = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestConcurrencyLimitWaits(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := middlewareConcurrencyLimit(1, time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	result := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		result <- rec.Code
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-started
+	if code := <-result; code != http.StatusOK {
+		t.Errorf("queued status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsMaxAge       = "600"
+)
+
+// corsAllowHeaders are the request headers browsers may send cross-origin.
+// Authorization must be here for authenticated calls to work.
+var corsAllowHeaders = strings.Join([]string{
+	"Authorization",
+	"Content-Type",
+	"Idempotency-Key",
+	"Accept-Version",
+	"X-Request-ID",
+}, ", ")
+
+// middlewareCORS lets browsers on origin call the API. Preflight OPTIONS
+// requests are answered with a 204 here and never reach the mux.
+func middlewareCORS(origin string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				h.Add("Vary", "Origin")
+			}
+			h.Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After, Deprecation, Sunset")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
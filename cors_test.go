@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareCORS(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		preflight     bool
+		wantStatus    int
+		wantNext      bool
+		wantAllowHdrs bool
+	}{
+		{
+			name:          "Preflight",
+			method:        http.MethodOptions,
+			preflight:     true,
+			wantStatus:    http.StatusNoContent,
+			wantNext:      false,
+			wantAllowHdrs: true,
+		},
+		{
+			name:       "Plain OPTIONS",
+			method:     http.MethodOptions,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "Simple request",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := middlewareCORS("https://app.example.com")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			req := httptest.NewRequest(tt.method, "/api/chirps", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "authorization")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next called = %v, want %v", called, tt.wantNext)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want the configured origin", got)
+			}
+			allowHeaders := rec.Header().Get("Access-Control-Allow-Headers")
+			if got := strings.Contains(allowHeaders, "Authorization"); got != tt.wantAllowHdrs {
+				t.Errorf("Access-Control-Allow-Headers = %q, want Authorization listed: %v", allowHeaders, tt.wantAllowHdrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor returns an opaque cursor pointing at the chirp with the given
+// creation time and ID, for keyset pagination. The cursor is signed with
+// secret so clients can't craft their own bounds.
+func encodeCursor(secret string, createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(raw))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signCursor(secret, payload))
+}
+
+func decodeCursor(secret, cursor string) (time.Time, uuid.UUID, error) {
+	payload, sig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return time.Time{}, uuid.UUID{}, errInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signCursor(secret, payload)) {
+		return time.Time{}, uuid.UUID{}, errInvalidCursor
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, errInvalidCursor
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.UUID{}, errInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, errInvalidCursor
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, errInvalidCursor
+	}
+	return createdAt, id, nil
+}
+
+func signCursor(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
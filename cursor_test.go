@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	createdAt := time.Date(2025, time.March, 1, 12, 30, 0, 123, time.UTC)
+	id := uuid.New()
+	valid := encodeCursor("secret", createdAt, id)
+	payload, sig, _ := strings.Cut(valid, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("2000-01-01T00:00:00Z|" + id.String()))
+
+	tests := []struct {
+		name    string
+		secret  string
+		cursor  string
+		wantErr bool
+	}{
+		{
+			name:    "Valid cursor",
+			secret:  "secret",
+			cursor:  valid,
+			wantErr: false,
+		},
+		{
+			name:    "Wrong secret",
+			secret:  "other",
+			cursor:  valid,
+			wantErr: true,
+		},
+		{
+			name:    "Tampered payload",
+			secret:  "secret",
+			cursor:  forged + "." + sig,
+			wantErr: true,
+		},
+		{
+			name:    "Missing signature",
+			secret:  "secret",
+			cursor:  payload,
+			wantErr: true,
+		},
+		{
+			name:    "Garbage",
+			secret:  "secret",
+			cursor:  "not-a-cursor",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTime, gotID, err := decodeCursor(tt.secret, tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCursor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!gotTime.Equal(createdAt) || gotID != id) {
+				t.Errorf("decodeCursor() = (%v, %v), want (%v, %v)", gotTime, gotID, createdAt, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// userIDBodySunset is when POST /api/chirps stops accepting user_id in the
+// request body; the author is always taken from the access token.
+var userIDBodySunset = time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// parseDeprecatedRoutes parses DEPRECATED_ROUTES, a semicolon-separated
+// list of "<mux pattern>=<sunset date>" entries such as
+// "GET /api/chirps/recent=2027-01-01", into the map middlewareDeprecation
+// takes.
+func parseDeprecatedRoutes(val string) (map[string]time.Time, error) {
+	routes := make(map[string]time.Time)
+	for _, entry := range strings.Split(val, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, date, ok := strings.Cut(entry, "=")
+		pattern = strings.Join(strings.Fields(pattern), " ")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("entry %q must look like \"GET /path=2027-01-01\"", entry)
+		}
+		sunset, err := time.Parse(time.DateOnly, strings.TrimSpace(date))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sunset date for %q: %w", pattern, err)
+		}
+		routes[pattern] = sunset
+	}
+	return routes, nil
+}
+
+var wildcardPattern = regexp.MustCompile(`\{[^}]*\}`)
+
+// unknownRoutes returns the patterns in routes that mux doesn't serve, which
+// would otherwise never get their headers.
+func unknownRoutes(mux *http.ServeMux, routes map[string]time.Time) []string {
+	var unknown []string
+	for pattern := range routes {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = http.MethodGet, pattern
+		}
+		path = wildcardPattern.ReplaceAllString(strings.TrimSuffix(path, "{$}"), "x")
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			unknown = append(unknown, pattern)
+			continue
+		}
+		if _, matched := mux.Handler(r); matched != pattern {
+			unknown = append(unknown, pattern)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// deprecate marks the response as using a deprecated API (RFC 8594).
+func deprecate(w http.ResponseWriter, sunset time.Time) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+}
+
+// middlewareDeprecation adds Deprecation and Sunset headers to responses for
+// any route whose mux pattern appears in sunsets.
+func middlewareDeprecation(mux *http.ServeMux, sunsets map[string]time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			if sunset, ok := sunsets[pattern]; ok {
+				deprecate(w, sunset)
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareDeprecation(t *testing.T) {
+	sunset := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /old", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /new", func(w http.ResponseWriter, r *http.Request) {})
+	handler := middlewareDeprecation(mux, map[string]time.Time{"GET /old": sunset})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantSunset string
+	}{
+		{
+			name:       "Deprecated route",
+			path:       "/old",
+			wantSunset: "Fri, 01 Jan 2027 00:00:00 GMT",
+		},
+		{
+			name:       "Current route",
+			path:       "/new",
+			wantSunset: "",
+		},
+		{
+			name:       "Unknown route",
+			path:       "/missing",
+			wantSunset: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := rec.Header().Get("Sunset"); got != tt.wantSunset {
+				t.Errorf("Sunset = %q, want %q", got, tt.wantSunset)
+			}
+			if got := rec.Header().Get("Deprecation") != ""; got != (tt.wantSunset != "") {
+				t.Errorf("Deprecation header present = %v, want %v", got, tt.wantSunset != "")
+			}
+		})
+	}
+}
+
+func TestParseDeprecatedRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		val     string
+		want    map[string]time.Time
+		wantErr bool
+	}{
+		{
+			name: "Unset",
+			val:  "",
+			want: map[string]time.Time{},
+		},
+		{
+			name: "Several routes",
+			val:  "GET /api/chirps/recent=2027-01-01; DELETE  /api/users = 2027-06-30;",
+			want: map[string]time.Time{
+				"GET /api/chirps/recent": time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC),
+				"DELETE /api/users":      time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "Missing date",
+			val:     "GET /api/chirps/recent",
+			wantErr: true,
+		},
+		{
+			name:    "Bad date",
+			val:     "GET /api/chirps/recent=01/01/2027",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDeprecatedRoutes(tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDeprecatedRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("parseDeprecatedRoutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeprecatedRouteFromConfig(t *testing.T) {
+	routes, err := parseDeprecatedRoutes("GET /api/chirps/{chirpID}=2027-01-01;GET /api/gone=2027-01-01")
+	if err != nil {
+		t.Fatalf("parseDeprecatedRoutes() error = %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {})
+
+	if got, want := unknownRoutes(mux, routes), []string{"GET /api/gone"}; !slices.Equal(got, want) {
+		t.Errorf("unknownRoutes() = %v, want %v", got, want)
+	}
+
+	handler := middlewareDeprecation(mux, routes)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps/3311741c-680c-4546-99f3-fc9efac2036c", nil))
+	if rec.Header().Get("Deprecation") != "true" || rec.Header().Get("Sunset") != "Fri, 01 Jan 2027 00:00:00 GMT" {
+		t.Errorf("headers = %v, want Deprecation and Sunset on the deprecated route", rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+	if rec.Header().Get("Deprecation") != "" {
+		t.Errorf("headers = %v, want no Deprecation on a current route", rec.Header())
+	}
+}
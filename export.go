@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+const exportPageSize = 100
+
+// handlerExportUser streams the authenticated user's profile, chirps and
+// session metadata as a single JSON document, fetching rows a page at a time
+// so prolific users don't have to fit in memory.
+func (cfg *apiConfig) handlerExportUser(w http.ResponseWriter, r *http.Request) {
+	if !cfg.enabled(featureExport) {
+		respondFeatureDisabled(w, "Exporting data")
+		return
+	}
+	userid, err := cfg.authenticateUser(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+	usr, ok := userFromContext(r)
+	if !ok || usr.ID != userid {
+		usr, err = cfg.loadUser(r, userid)
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't get user: %w", err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.json"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent from here on, so failures can only be logged and the
+	// document left truncated.
+	if err := cfg.writeExport(w, r, usr); err != nil {
+		log.Printf("export for user %s failed (request %s): %s", usr.ID, requestID(r), err)
+	}
+}
+
+func (cfg *apiConfig) writeExport(w http.ResponseWriter, r *http.Request, usr database.User) error {
+	enc := json.NewEncoder(w)
+
+	w.Write([]byte(`{"profile":`))
+	err := enc.Encode(userToResponse(usr, userResponseOpts{V2: wantsV2(r)}))
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(`,"chirps":[`))
+	params := database.GetChirpsByAuthorPageParams{
+		UserID:   usr.ID,
+		RowLimit: exportPageSize,
+	}
+	first := true
+	for {
+		chirps, err := cfg.queries.GetChirpsByAuthorPage(r.Context(), params)
+		if err != nil {
+			return fmt.Errorf("couldn't get chirps: %w", err)
+		}
+		for _, chirp := range chirps {
+			if !first {
+				w.Write([]byte(","))
+			}
+			first = false
+			if err := enc.Encode(newChirp(chirp)); err != nil {
+				return err
+			}
+		}
+		if len(chirps) < exportPageSize {
+			break
+		}
+		last := chirps[len(chirps)-1]
+		params.AfterCreatedAt = last.CreatedAt
+		params.AfterID = last.ID
+	}
+
+	type session struct {
+		CreatedAt time.Time  `json:"created_at"`
+		ExpiresAt time.Time  `json:"expires_at"`
+		RevokedAt *time.Time `json:"revoked_at"`
+	}
+	w.Write([]byte(`],"sessions":[`))
+	first = true
+	for offset := int32(0); ; offset += exportPageSize {
+		tokens, err := cfg.queries.ListRefreshTokens(r.Context(), database.ListRefreshTokensParams{
+			UserID:    uuid.NullUUID{UUID: usr.ID, Valid: true},
+			State:     "all",
+			RowLimit:  exportPageSize,
+			RowOffset: offset,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't get sessions: %w", err)
+		}
+		for _, token := range tokens {
+			if !first {
+				w.Write([]byte(","))
+			}
+			first = false
+			s := session{CreatedAt: token.CreatedAt, ExpiresAt: token.ExpiresAt}
+			if token.RevokedAt.Valid {
+				s.RevokedAt = &token.RevokedAt.Time
+			}
+			if err := enc.Encode(s); err != nil {
+				return err
+			}
+		}
+		if len(tokens) < exportPageSize {
+			break
+		}
+	}
+	_, err = w.Write([]byte("]}\n"))
+	return err
+}
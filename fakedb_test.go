@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+// txRecorder is a minimal database/sql driver that records how transactions
+// end and fails any statement whose query matches failQuery. The only query
+// it answers is GetUserByID for user, so handlers can authenticate.
+type txRecorder struct {
+	mu        sync.Mutex
+	commits   int
+	rollbacks int
+	execs     []string
+	failQuery string
+	user      uuid.UUID
+}
+
+func (d *txRecorder) Open(name string) (driver.Conn, error) { return &txConn{d: d}, nil }
+
+type txConn struct{ d *txRecorder }
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *txConn) Close() error              { return nil }
+func (c *txConn) Begin() (driver.Tx, error) { return &txTx{d: c.d}, nil }
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if query == c.d.failQuery {
+		return nil, errors.New("forced failure")
+	}
+	c.d.execs = append(c.d.execs, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *txConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryName(query) != "GetUserByID" || c.d.user == uuid.Nil {
+		return nil, errors.New("query not supported")
+	}
+	userCols := []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "is_active"}
+	if args[0].Value != c.d.user.String() {
+		return &memRows{cols: userCols}, nil
+	}
+	now := time.Now()
+	return &memRows{cols: userCols, data: [][]driver.Value{{c.d.user.String(), now, now, "user@example.com", "hash", false, true}}}, nil
+}
+
+type txTx struct{ d *txRecorder }
+
+func (t *txTx) Commit() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.commits++
+	return nil
+}
+
+func (t *txTx) Rollback() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.rollbacks++
+	return nil
+}
+
+const deleteAllChirpsQuery = "-- name: DeleteAllChirps :execrows\nDELETE FROM chirps *\n"
+
+func newTxTestConfig(t *testing.T, d *txRecorder) *apiConfig {
+	db := sql.OpenDB(connector{d})
+	t.Cleanup(func() { db.Close() })
+	return &apiConfig{db: db, queries: database.New(db), checkUserExists: true}
+}
+
+type connector struct{ d *txRecorder }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+// hashtagMatch mirrors the hashtag pattern of the GetTrendingHashtags query.
+var hashtagMatch = regexp.MustCompile(`(^|\s)#([[:alnum:]_]+)`)
+
+// chirpStore is a database/sql driver that keeps chirps in memory. Rows
+// inserted inside a transaction stay invisible to other connections until
+// it commits.
+type chirpStore struct {
+	mu        sync.Mutex
+	committed map[string][]driver.Value
+	users     map[string][]driver.Value
+	tokens    map[string][]driver.Value
+	resets    map[string][]driver.Value
+	keys      map[string][]driver.Value
+	flags     map[string][]driver.Value
+	audit     [][]driver.Value
+	commits   int
+	// beforeExec, when set, runs under the store lock before each Exec, so
+	// a test can commit a competing write at exactly that point.
+	beforeExec func(query string)
+	// failQuery names a query that fails as if the connection dropped.
+	failQuery string
+	// queried counts the queries run, by name.
+	queried map[string]int
+}
+
+func (s *chirpStore) Open(name string) (driver.Conn, error) { return &chirpStoreConn{s: s}, nil }
+
+func (s *chirpStore) Connect(context.Context) (driver.Conn, error) { return s.Open("") }
+func (s *chirpStore) Driver() driver.Driver                        { return s }
+
+// seed stores a committed chirp by userID created at createdAt.
+func (s *chirpStore) seed(userID uuid.UUID, body string, createdAt time.Time) uuid.UUID {
+	id := uuid.New()
+	s.committed[id.String()] = []driver.Value{id.String(), createdAt, createdAt, body, userID.String(), false, nil, nil}
+	return id
+}
+
+// seedUser stores an active user with the given email.
+func (s *chirpStore) seedUser(email string) uuid.UUID {
+	id := uuid.New()
+	now := time.Now()
+	s.users[id.String()] = []driver.Value{id.String(), now, now, email, "$2a$10$secrethash", false, true}
+	return id
+}
+
+// seedRefreshToken stores a refresh token for userID valid for an hour.
+func (s *chirpStore) seedRefreshToken(userID uuid.UUID) string {
+	token := uuid.NewString()
+	now := time.Now()
+	s.tokens[token] = []driver.Value{token, now, now, userID.String(), now.Add(time.Hour), nil}
+	return token
+}
+
+// sorted returns the committed chirps oldest first.
+func (s *chirpStore) sorted() [][]driver.Value {
+	rows := make([][]driver.Value, 0, len(s.committed))
+	for _, row := range s.committed {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i][1].(time.Time), rows[j][1].(time.Time)
+		if a.Equal(b) {
+			return rows[i][0].(string) < rows[j][0].(string)
+		}
+		return a.Before(b)
+	})
+	return rows
+}
+
+type chirpStoreConn struct {
+	s       *chirpStore
+	pending map[string][]driver.Value
+}
+
+func (c *chirpStoreConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *chirpStoreConn) Close() error { return nil }
+
+func (c *chirpStoreConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[string][]driver.Value)
+	return c, nil
+}
+
+func (c *chirpStoreConn) Commit() error {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for id, row := range c.pending {
+		c.s.committed[id] = row
+	}
+	c.s.commits++
+	c.pending = nil
+	return nil
+}
+
+func (c *chirpStoreConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+func (c *chirpStoreConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if c.s.beforeExec != nil {
+		c.s.beforeExec(queryName(query))
+	}
+	switch queryName(query) {
+	case "CreateIdempotencyKey":
+		k := args[1].Value.(string) + "/" + args[0].Value.(string)
+		if row, ok := c.s.keys[k]; ok && row[4].(time.Time).After(time.Now()) {
+			return driver.RowsAffected(0), nil
+		}
+		c.s.keys[k] = []driver.Value{args[0].Value, args[1].Value, args[2].Value, time.Now(), args[3].Value}
+		return driver.RowsAffected(1), nil
+	case "CreateAuditLogEntry":
+		c.s.audit = append(c.s.audit, []driver.Value{uuid.NewString(), time.Now(), args[0].Value, args[1].Value, args[2].Value, args[3].Value})
+		return driver.RowsAffected(1), nil
+	case "InvalidatePasswordResetTokens":
+		var n int64
+		for _, row := range c.s.resets {
+			if row[2] == args[0].Value && row[4] == nil {
+				row[4] = time.Now()
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	case "UpdateUserPassword":
+		row, ok := c.s.users[args[1].Value.(string)]
+		if !ok {
+			return driver.RowsAffected(0), nil
+		}
+		row[2], row[4] = time.Now(), args[0].Value
+		return driver.RowsAffected(1), nil
+	case "RevokeAllRefreshTokensForUser":
+		var n int64
+		for _, row := range c.s.tokens {
+			if row[3] == args[0].Value && row[5] == nil {
+				row[5] = time.Now()
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	}
+	return nil, fmt.Errorf("unexpected exec %s", queryName(query))
+}
+
+func (c *chirpStoreConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	cols := []string{"id", "created_at", "updated_at", "body", "user_id", "is_sensitive", "quoted_chirp_id", "publish_at"}
+	resetCols := []string{"token", "created_at", "user_id", "expires_at", "used_at"}
+	c.s.queried[queryName(query)]++
+	if queryName(query) == c.s.failQuery {
+		return nil, fmt.Errorf("%s: connection reset", c.s.failQuery)
+	}
+	switch queryName(query) {
+	case "CreateChirp":
+		now := time.Now()
+		id := uuid.NewString()
+		row := []driver.Value{id, now, now, args[0].Value, args[1].Value, args[2].Value, args[3].Value, args[4].Value}
+		if c.pending != nil {
+			c.pending[id] = row
+		} else {
+			c.s.committed[id] = row
+		}
+		return &memRows{cols: cols, data: [][]driver.Value{row}}, nil
+	case "GetChirpByID":
+		id, _ := args[0].Value.(string)
+		if row, ok := c.pending[id]; ok {
+			return &memRows{cols: cols, data: [][]driver.Value{row}}, nil
+		}
+		if row, ok := c.s.committed[id]; ok {
+			return &memRows{cols: cols, data: [][]driver.Value{row}}, nil
+		}
+		return &memRows{cols: cols}, nil
+	case "GetIdempotencyKey":
+		keyCols := []string{"key", "user_id", "chirp_id", "created_at", "expires_at"}
+		row, ok := c.s.keys[args[0].Value.(string)+"/"+args[1].Value.(string)]
+		if !ok || !row[4].(time.Time).After(time.Now()) {
+			return &memRows{cols: keyCols}, nil
+		}
+		return &memRows{cols: keyCols, data: [][]driver.Value{row}}, nil
+	case "UpdateChirp":
+		id, _ := args[1].Value.(string)
+		row, ok := c.s.committed[id]
+		if !ok {
+			return &memRows{cols: cols}, nil
+		}
+		row[2], row[3] = time.Now(), args[0].Value
+		return &memRows{cols: cols, data: [][]driver.Value{row}}, nil
+	case "CreateUser":
+		email := args[0].Value.(string)
+		for _, row := range c.s.users {
+			if strings.EqualFold(row[3].(string), email) {
+				return nil, &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+			}
+		}
+		id := uuid.NewString()
+		now := time.Now()
+		row := []driver.Value{id, now, now, email, args[1].Value, false, true}
+		c.s.users[id] = row
+		return &memRows{cols: []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "is_active"}, data: [][]driver.Value{row}}, nil
+	case "UpdateUser":
+		userCols := []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "is_active"}
+		row, ok := c.s.users[args[2].Value.(string)]
+		if !ok {
+			return &memRows{cols: userCols}, nil
+		}
+		if email, ok := args[0].Value.(string); ok {
+			for id, other := range c.s.users {
+				if id != row[0] && strings.EqualFold(other[3].(string), email) {
+					return nil, &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+				}
+			}
+			row[3] = email
+		}
+		if hashed, ok := args[1].Value.(string); ok {
+			row[4] = hashed
+		}
+		row[2] = time.Now()
+		return &memRows{cols: userCols, data: [][]driver.Value{row}}, nil
+	case "UpgradeUser":
+		userCols := []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "is_active"}
+		row, ok := c.s.users[args[0].Value.(string)]
+		if !ok {
+			return &memRows{cols: userCols}, nil
+		}
+		row[5] = true
+		return &memRows{cols: userCols, data: [][]driver.Value{row}}, nil
+	case "GetUserByEmail":
+		userCols := []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "is_active"}
+		for _, row := range c.s.users {
+			if strings.EqualFold(row[3].(string), args[0].Value.(string)) {
+				return &memRows{cols: userCols, data: [][]driver.Value{row}}, nil
+			}
+		}
+		return &memRows{cols: userCols}, nil
+	case "GetUserByID", "GetUserFromRefreshToken":
+		userCols := []string{"id", "created_at", "updated_at", "email", "hashed_password", "is_chirpy_red", "is_active"}
+		id := args[0].Value.(string)
+		if token, ok := c.s.tokens[id]; ok {
+			id = token[3].(string)
+		}
+		if row, ok := c.s.users[id]; ok {
+			return &memRows{cols: userCols, data: [][]driver.Value{row}}, nil
+		}
+		return &memRows{cols: userCols}, nil
+	case "CreateRefreshToken":
+		now := time.Now()
+		row := []driver.Value{args[0].Value, now, now, args[1].Value, args[2].Value, nil}
+		c.s.tokens[args[0].Value.(string)] = row
+		return &memRows{cols: []string{"token", "created_at", "updated_at", "user_id", "expires_at", "revoked_at"}, data: [][]driver.Value{row}}, nil
+	case "SetFeatureFlag":
+		row := []driver.Value{args[0].Value, args[1].Value, time.Now()}
+		c.s.flags[args[0].Value.(string)] = row
+		return &memRows{cols: []string{"name", "enabled", "updated_at"}, data: [][]driver.Value{row}}, nil
+	case "ListFeatureFlags":
+		var rows [][]driver.Value
+		for _, row := range c.s.flags {
+			rows = append(rows, row)
+		}
+		return &memRows{cols: []string{"name", "enabled", "updated_at"}, data: rows}, nil
+	case "ListAuditLog":
+		var rows [][]driver.Value
+		for i := len(c.s.audit) - 1; i >= 0; i-- {
+			row := c.s.audit[i]
+			if (args[0].Value == nil || row[2] == args[0].Value) && (args[1].Value == nil || row[3] == args[1].Value) {
+				rows = append(rows, row)
+			}
+		}
+		limit, offset := int(args[2].Value.(int64)), int(args[3].Value.(int64))
+		rows = rows[min(offset, len(rows)):min(offset+limit, len(rows))]
+		return &memRows{cols: []string{"id", "created_at", "actor_id", "action", "target_id", "ip"}, data: rows}, nil
+	case "GetRefreshToken":
+		tokenCols := []string{"token", "created_at", "updated_at", "user_id", "expires_at", "revoked_at"}
+		if row, ok := c.s.tokens[args[0].Value.(string)]; ok {
+			return &memRows{cols: tokenCols, data: [][]driver.Value{row}}, nil
+		}
+		return &memRows{cols: tokenCols}, nil
+	case "CreatePasswordResetToken":
+		row := []driver.Value{args[0].Value, time.Now(), args[1].Value, args[2].Value, nil}
+		c.s.resets[args[0].Value.(string)] = row
+		return &memRows{cols: resetCols, data: [][]driver.Value{row}}, nil
+	case "ConsumePasswordResetToken":
+		row, ok := c.s.resets[args[0].Value.(string)]
+		if !ok || row[4] != nil || !row[3].(time.Time).After(time.Now()) {
+			return &memRows{cols: resetCols}, nil
+		}
+		row[4] = time.Now()
+		return &memRows{cols: resetCols, data: [][]driver.Value{row}}, nil
+	case "GetChirpsByIDs":
+		var rows [][]driver.Value
+		for _, id := range strings.Split(strings.Trim(args[0].Value.(string), `{}"`), `","`) {
+			row, ok := c.s.committed[id]
+			if !ok {
+				continue
+			}
+			if author, ok := c.s.users[row[4].(string)]; ok && author[6] == true {
+				rows = append(rows, row)
+			}
+		}
+		return &memRows{cols: cols, data: rows}, nil
+	case "GetAllChirps":
+		return &memRows{cols: cols, data: c.s.sorted()}, nil
+	case "GetChirpsByAuthor":
+		var rows [][]driver.Value
+		for _, row := range c.s.sorted() {
+			if row[4] == args[0].Value {
+				rows = append(rows, row)
+			}
+		}
+		return &memRows{cols: cols, data: rows}, nil
+	case "GetTrendingHashtags":
+		window := args[0].Value.(float64)
+		now := time.Now()
+		type tagStats struct {
+			uses  int64
+			score float64
+		}
+		stats := make(map[string]*tagStats)
+		for _, row := range c.s.committed {
+			if author, ok := c.s.users[row[4].(string)]; !ok || author[6] != true {
+				continue
+			}
+			at := row[1].(time.Time)
+			if publishAt, ok := row[7].(time.Time); ok {
+				at = publishAt
+			}
+			age := now.Sub(at).Seconds()
+			if age < 0 || age >= window {
+				continue
+			}
+			for _, m := range hashtagMatch.FindAllStringSubmatch(row[3].(string), -1) {
+				tag := strings.ToLower(m[2])
+				if stats[tag] == nil {
+					stats[tag] = &tagStats{}
+				}
+				stats[tag].uses++
+				stats[tag].score += 1 - age/window
+			}
+		}
+		var rows [][]driver.Value
+		for tag, s := range stats {
+			rows = append(rows, []driver.Value{tag, s.uses, s.score})
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i][2] != rows[j][2] {
+				return rows[i][2].(float64) > rows[j][2].(float64)
+			}
+			return rows[i][0].(string) < rows[j][0].(string)
+		})
+		rows = rows[:min(int(args[1].Value.(int64)), len(rows))]
+		return &memRows{cols: []string{"tag", "uses", "score"}, data: rows}, nil
+	case "GetRecentChirps":
+		rows := c.s.sorted()
+		slices.Reverse(rows)
+		return &memRows{cols: cols, data: rows[:min(int(args[0].Value.(int64)), len(rows))]}, nil
+	case "GetChirpsPaginated", "GetFeedChirps":
+		desc := queryName(query) == "GetFeedChirps"
+		rows := c.s.sorted()
+		if desc {
+			slices.Reverse(rows)
+		}
+		var cursorAt time.Time
+		var cursorID string
+		if args[2].Value != nil {
+			cursorAt, cursorID = args[2].Value.(time.Time), args[3].Value.(string)
+		}
+		var page [][]driver.Value
+		for _, row := range rows {
+			if args[0].Value != nil && row[4] != args[0].Value {
+				continue
+			}
+			at, id := row[1].(time.Time), row[0].(string)
+			after := at.After(cursorAt) || at.Equal(cursorAt) && id > cursorID
+			before := at.Before(cursorAt) || at.Equal(cursorAt) && id < cursorID
+			if !cursorAt.IsZero() && (desc && !before || !desc && !after) {
+				continue
+			}
+			if int64(len(page)) == args[4].Value.(int64) {
+				break
+			}
+			page = append(page, row)
+		}
+		return &memRows{cols: cols, data: page}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %s", queryName(query))
+}
+
+type memRows struct {
+	cols []string
+	data [][]driver.Value
+}
+
+func (r *memRows) Columns() []string { return r.cols }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+
+func newChirpStoreConfig(t *testing.T) (*apiConfig, *chirpStore) {
+	store := &chirpStore{
+		committed: make(map[string][]driver.Value),
+		users:     make(map[string][]driver.Value),
+		tokens:    make(map[string][]driver.Value),
+		resets:    make(map[string][]driver.Value),
+		keys:      make(map[string][]driver.Value),
+		flags:     make(map[string][]driver.Value),
+		queried:   make(map[string]int),
+	}
+	db := sql.OpenDB(store)
+	t.Cleanup(func() { db.Close() })
+	cfg := &apiConfig{db: db, queries: database.New(db), secret: "secret", idempotencyTTL: time.Hour, checkUserExists: true}
+	cfg.readQueries = cfg.queries
+	cfg.profaneWords = defaultProfaneWords
+	return cfg, store
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+// handlerGetFeed lists chirps newest-first with keyset pagination. Unlike
+// GET /api/chirps, which returns a bare array oldest-first, the feed returns
+// {"chirps": [...], "next_cursor": "..."}; pass next_cursor back as cursor
+// to fetch the following page. An empty next_cursor means no more chirps.
+func (cfg *apiConfig) handlerGetFeed(w http.ResponseWriter, r *http.Request) {
+	var author uuid.NullUUID
+	if authorID := r.URL.Query().Get("author_id"); authorID != "" {
+		uid, err := uuid.Parse(authorID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error bad user id: %v", err))
+			return
+		}
+		author = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+	cfg.serveFeed(w, r, author)
+}
+
+// handlerGetUserChirps is a single user's timeline, paginated exactly like
+// the feed.
+func (cfg *apiConfig) handlerGetUserChirps(w http.ResponseWriter, r *http.Request) {
+	uid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error bad user id: %v", err))
+		return
+	}
+	usr, err := cfg.readQueries.GetUserByID(r.Context(), uid)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !usr.IsActive) {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't get user: %w", err))
+		return
+	}
+	cfg.serveFeed(w, r, uuid.NullUUID{UUID: uid, Valid: true})
+}
+
+// serveFeed writes one page of published chirps, optionally limited to a
+// single author, newest first.
+func (cfg *apiConfig) serveFeed(w http.ResponseWriter, r *http.Request, author uuid.NullUUID) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg.serveChirpPage(w, r, fields, author, true)
+}
+
+// serveChirpPage writes one page of published chirps, optionally limited to
+// a single author, oldest first unless desc is set. The page is wrapped as
+// {"chirps": [...], "next_cursor": "..."}, and the cursor bounds the next
+// page from below or, with desc, from above.
+func (cfg *apiConfig) serveChirpPage(w http.ResponseWriter, r *http.Request, fields map[string]struct{}, author uuid.NullUUID, desc bool) {
+	query := r.URL.Query()
+	excludeSensitive := query.Get("exclude_sensitive") == "true"
+	var cursorAt sql.NullTime
+	var cursorID uuid.NullUUID
+	if cursor := query.Get("cursor"); cursor != "" {
+		createdAt, id, err := decodeCursor(cfg.secret, cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cursorAt = sql.NullTime{Time: createdAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	limit, err := parseLimit(r, 50, 100)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var chirps []database.Chirp
+	if desc {
+		chirps, err = cfg.readQueries.GetFeedChirps(r.Context(), database.GetFeedChirpsParams{
+			AuthorID:         author,
+			ExcludeSensitive: excludeSensitive,
+			BeforeCreatedAt:  cursorAt,
+			BeforeID:         cursorID,
+			RowLimit:         limit,
+		})
+	} else {
+		chirps, err = cfg.readQueries.GetChirpsPaginated(r.Context(), database.GetChirpsPaginatedParams{
+			AuthorID:         author,
+			ExcludeSensitive: excludeSensitive,
+			AfterCreatedAt:   cursorAt,
+			AfterID:          cursorID,
+			RowLimit:         limit,
+		})
+	}
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't get chirps: %w", err))
+		return
+	}
+	res, err := cfg.decorateChirps(r, chirps, fields)
+	if err != nil {
+		respondInternal(w, r, err)
+		return
+	}
+	nextCursor := ""
+	if len(chirps) == int(limit) {
+		last := chirps[len(chirps)-1]
+		nextCursor = encodeCursor(cfg.secret, last.CreatedAt, last.ID)
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		Chirps     []any  `json:"chirps"`
+		NextCursor string `json:"next_cursor"`
+	}{res, nextCursor})
+}
+
+const (
+	defaultRecentChirps = 10
+	maxRecentChirps     = 50
+	// loginRecentChirps is how many chirps POST /api/login?include=chirps embeds.
+	loginRecentChirps = 5
+)
+
+// handlerGetRecentChirps returns the newest count chirps, newest first.
+func (cfg *apiConfig) handlerGetRecentChirps(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	count := int32(defaultRecentChirps)
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid count %q", v))
+			return
+		}
+		count = int32(min(n, maxRecentChirps))
+	}
+	chirps, err := cfg.readQueries.GetRecentChirps(r.Context(), count)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't get recent chirps: %w", err))
+		return
+	}
+	res, err := cfg.decorateChirps(r, chirps, fields)
+	if err != nil {
+		respondInternal(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
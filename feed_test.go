@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGetChirpsPaginated(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	author := uuid.New()
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"first", "second", "third"} {
+		store.seed(author, body, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	type page struct {
+		Chirps []struct {
+			Body string `json:"body"`
+		} `json:"chirps"`
+		NextCursor string `json:"next_cursor"`
+	}
+	get := func(target string) (int, page) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerGetChirps(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var p page
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("couldn't decode page: %v", err)
+			}
+		}
+		return rec.Code, p
+	}
+
+	code, first := get("/api/chirps?limit=2")
+	if code != http.StatusOK || len(first.Chirps) != 2 || first.Chirps[0].Body != "first" || first.NextCursor == "" {
+		t.Fatalf("first page = %d %+v, want first and second with a cursor", code, first)
+	}
+	code, second := get("/api/chirps?limit=2&cursor=" + first.NextCursor)
+	if code != http.StatusOK || len(second.Chirps) != 1 || second.Chirps[0].Body != "third" || second.NextCursor != "" {
+		t.Fatalf("second page = %d %+v, want third and no cursor", code, second)
+	}
+	if code, _ := get("/api/chirps?cursor=not-a-cursor"); code != http.StatusBadRequest {
+		t.Errorf("invalid cursor status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestGetChirpsSort(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	author := uuid.New()
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	store.seed(author, "second", start.Add(time.Minute))
+	store.seed(author, "third", start.Add(2*time.Minute))
+	store.seed(author, "first", start)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "Default is ascending",
+			target:     "/api/chirps",
+			wantStatus: http.StatusOK,
+			want:       []string{"first", "second", "third"},
+		},
+		{
+			name:       "Ascending",
+			target:     "/api/chirps?sort=asc",
+			wantStatus: http.StatusOK,
+			want:       []string{"first", "second", "third"},
+		},
+		{
+			name:       "Descending",
+			target:     "/api/chirps?sort=desc",
+			wantStatus: http.StatusOK,
+			want:       []string{"third", "second", "first"},
+		},
+		{
+			name:       "Descending page",
+			target:     "/api/chirps?sort=desc&limit=2",
+			wantStatus: http.StatusOK,
+			want:       []string{"third", "second"},
+		},
+		{
+			name:       "Invalid sort",
+			target:     "/api/chirps?sort=newest",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			cfg.handlerGetChirps(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.want == nil {
+				return
+			}
+			var chirps []Chirp
+			if strings.Contains(tt.target, "limit=") {
+				var page struct {
+					Chirps []Chirp `json:"chirps"`
+				}
+				json.NewDecoder(rec.Body).Decode(&page)
+				chirps = page.Chirps
+			} else {
+				json.NewDecoder(rec.Body).Decode(&chirps)
+			}
+			got := make([]string, len(chirps))
+			for i, c := range chirps {
+				got[i] = c.Body
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bodies = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChirpsByAuthor(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	author, other := uuid.New(), uuid.New()
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	store.seed(author, "mine", start)
+	store.seed(other, "theirs", start.Add(time.Minute))
+
+	tests := []struct {
+		name       string
+		authorID   string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Author with chirps",
+			authorID:   author.String(),
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"id":`,
+		},
+		{
+			name:       "Author without chirps",
+			authorID:   uuid.NewString(),
+			wantStatus: http.StatusOK,
+			wantBody:   "[]",
+		},
+		{
+			name:       "Malformed author id",
+			authorID:   "not-a-uuid",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"Error bad user id`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			cfg.handlerGetChirps(rec, httptest.NewRequest(http.MethodGet, "/api/chirps?author_id="+tt.authorID, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if body := rec.Body.String(); !strings.HasPrefix(body, tt.wantBody) {
+				t.Errorf("body = %s, want prefix %s", body, tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && tt.wantBody != "[]" {
+				var chirps []Chirp
+				json.Unmarshal(rec.Body.Bytes(), &chirps)
+				if len(chirps) != 1 || chirps[0].Body != "mine" {
+					t.Errorf("chirps = %+v, want only the author's chirp", chirps)
+				}
+			}
+		})
+	}
+}
+
+func TestChirpEntities(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	author := store.seedUser("user@example.com")
+	chirpID := store.seed(author, "hello #chirpy", time.Now())
+
+	tests := []struct {
+		name    string
+		target  string
+		handler func(w http.ResponseWriter, r *http.Request)
+		wrapped bool
+		single  bool
+	}{
+		{
+			name:    "Feed",
+			target:  "/api/feed",
+			handler: cfg.handlerGetFeed,
+			wrapped: true,
+		},
+		{
+			name:    "User timeline",
+			target:  "/api/users/" + author.String() + "/chirps",
+			handler: cfg.handlerGetUserChirps,
+			wrapped: true,
+		},
+		{
+			name:    "Recent chirps",
+			target:  "/api/chirps/recent",
+			handler: cfg.handlerGetRecentChirps,
+		},
+		{
+			name:    "All chirps",
+			target:  "/api/chirps",
+			handler: cfg.handlerGetChirps,
+		},
+		{
+			name:    "Single chirp",
+			target:  "/api/chirps/" + chirpID.String(),
+			handler: cfg.handlerGetChirpByID,
+			single:  true,
+		},
+		{
+			name:    "Chirps page",
+			target:  "/api/chirps?limit=10",
+			handler: cfg.handlerGetChirps,
+			wrapped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, entities := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s entities=%v", tt.name, entities), func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+				if entities {
+					query := req.URL.Query()
+					query.Set("entities", "true")
+					req.URL.RawQuery = query.Encode()
+				}
+				req.SetPathValue("userID", author.String())
+				req.SetPathValue("chirpID", chirpID.String())
+				rec := httptest.NewRecorder()
+				tt.handler(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+				}
+				var chirps []Chirp
+				var err error
+				switch {
+				case tt.single:
+					var chirp Chirp
+					err = json.NewDecoder(rec.Body).Decode(&chirp)
+					chirps = []Chirp{chirp}
+				case tt.wrapped:
+					var page struct {
+						Chirps []Chirp `json:"chirps"`
+					}
+					err = json.NewDecoder(rec.Body).Decode(&page)
+					chirps = page.Chirps
+				default:
+					err = json.NewDecoder(rec.Body).Decode(&chirps)
+				}
+				if err != nil || len(chirps) != 1 {
+					t.Fatalf("response = %v chirps, error %v, want 1 chirp", len(chirps), err)
+				}
+				got := chirps[0].Entities
+				if !entities {
+					if got != nil {
+						t.Errorf("Entities = %+v, want none without ?entities=true", got)
+					}
+					return
+				}
+				if got == nil || len(got.Hashtags) != 1 || got.Hashtags[0].Text != "#chirpy" {
+					t.Errorf("Entities = %+v, want the #chirpy hashtag", got)
+				}
+			})
+		}
+	}
+}
+
+func TestDescendingChirpPagesMatchFeed(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	author, other := uuid.New(), uuid.New()
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"one", "two", "three", "four", "five"} {
+		store.seed(author, body, start.Add(time.Duration(i)*time.Minute))
+		store.seed(other, "other "+body, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	walk := func(handler http.HandlerFunc, target string) []string {
+		t.Helper()
+		var bodies []string
+		cursor := ""
+		for {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, target+"&cursor="+cursor, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s status = %d: %s", target, rec.Code, rec.Body)
+			}
+			var page struct {
+				Chirps []struct {
+					Body string `json:"body"`
+				} `json:"chirps"`
+				NextCursor string `json:"next_cursor"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+				t.Fatalf("couldn't decode page: %v", err)
+			}
+			for _, c := range page.Chirps {
+				bodies = append(bodies, c.Body)
+			}
+			if page.NextCursor == "" {
+				return bodies
+			}
+			cursor = page.NextCursor
+		}
+	}
+
+	want := []string{"five", "four", "three", "two", "one"}
+	query := "?limit=2&author_id=" + author.String()
+	if got := walk(cfg.handlerGetFeed, "/api/feed"+query); !reflect.DeepEqual(got, want) {
+		t.Errorf("feed = %v, want %v", got, want)
+	}
+	if got := walk(cfg.handlerGetChirps, "/api/chirps"+query+"&sort=desc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("chirps sorted desc = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// chirpFields are the top-level JSON keys a client may select with ?fields=.
+var chirpFields = map[string]struct{}{
+	"id":              {},
+	"created_at":      {},
+	"updated_at":      {},
+	"body":            {},
+	"user_id":         {},
+	"is_sensitive":    {},
+	"quoted_chirp_id": {},
+	"publish_at":      {},
+	"quoted_chirp":    {},
+	"entities":        {},
+	"author":          {},
+}
+
+// wantsExpand reports whether the comma-separated expand query parameter
+// includes name.
+func wantsExpand(r *http.Request, name string) bool {
+	for _, e := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		if strings.TrimSpace(e) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFields reads the comma-separated fields query parameter. A nil set
+// means the parameter was absent and the full object should be returned.
+func parseFields(r *http.Request) (map[string]struct{}, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+	fields := make(map[string]struct{})
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if _, ok := chirpFields[f]; !ok {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields[f] = struct{}{}
+	}
+	return fields, nil
+}
+
+// projectChirp returns only the selected fields of chirp, or chirp itself
+// when fields is nil.
+func projectChirp(chirp Chirp, fields map[string]struct{}) (any, error) {
+	if fields == nil {
+		return chirp, nil
+	}
+	data, err := json.Marshal(chirp)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	projected := make(map[string]json.RawMessage, len(fields))
+	for f := range fields {
+		if v, ok := all[f]; ok {
+			projected[f] = v
+		}
+	}
+	return projected, nil
+}
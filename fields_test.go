@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+func TestProjectChirp(t *testing.T) {
+	chirp := newChirp(database.Chirp{
+		ID:     uuid.MustParse("7d0a0c8e-3c4b-4b0e-9e8b-2f6f0b3f8a11"),
+		Body:   "hello",
+		UserID: uuid.MustParse("c2b1b3a4-5d6e-4f70-8a9b-0c1d2e3f4a5b"),
+	})
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "Selected fields",
+			query: "?fields=id,body",
+			want:  `{"body":"hello","id":"7d0a0c8e-3c4b-4b0e-9e8b-2f6f0b3f8a11"}`,
+		},
+		{
+			name:  "Omitted optional field",
+			query: "?fields=body,quoted_chirp",
+			want:  `{"body":"hello"}`,
+		},
+		{
+			name:    "Unknown field",
+			query:   "?fields=id,password",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := parseFields(httptest.NewRequest("GET", "/api/chirps"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := projectChirp(chirp, fields)
+			if err != nil {
+				t.Fatalf("projectChirp() error = %v", err)
+			}
+			var gotMap, wantMap map[string]any
+			data, _ := json.Marshal(got)
+			json.Unmarshal(data, &gotMap)
+			json.Unmarshal([]byte(tt.want), &wantMap)
+			if !reflect.DeepEqual(gotMap, wantMap) {
+				t.Errorf("projectChirp() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
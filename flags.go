@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+const (
+	featureScheduling = "scheduling"
+	featureQuotes     = "quotes"
+	featureExport     = "export"
+)
+
+// knownFeatures are the flags the code checks. Setting any other name would
+// create a flag that gates nothing.
+var knownFeatures = []string{featureExport, featureQuotes, featureScheduling}
+
+// respondFeatureDisabled is the response of every gated feature that is
+// switched off: it exists, it's just unavailable for now.
+func respondFeatureDisabled(w http.ResponseWriter, what string) {
+	respondWithError(w, http.StatusServiceUnavailable, what+" is currently disabled")
+}
+
+// featureFlags caches the feature_flags table. Flags missing from the table
+// are treated as enabled so that new gates don't switch features off.
+type featureFlags struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+func (ff *featureFlags) set(flags []database.FeatureFlag) {
+	m := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		m[flag.Name] = flag.Enabled
+	}
+	ff.mu.Lock()
+	ff.flags = m
+	ff.mu.Unlock()
+}
+
+func (cfg *apiConfig) enabled(name string) bool {
+	cfg.featureFlags.mu.RLock()
+	defer cfg.featureFlags.mu.RUnlock()
+	enabled, ok := cfg.featureFlags.flags[name]
+	return !ok || enabled
+}
+
+func (cfg *apiConfig) loadFeatureFlags(ctx context.Context) error {
+	flags, err := cfg.queries.ListFeatureFlags(ctx)
+	if err != nil {
+		return err
+	}
+	cfg.featureFlags.set(flags)
+	return nil
+}
+
+// refreshFeatureFlags reloads the flags every interval so changes made by
+// other instances are picked up. It runs for the lifetime of the process.
+func (cfg *apiConfig) refreshFeatureFlags(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := cfg.loadFeatureFlags(context.Background()); err != nil {
+			log.Printf("failed to refresh feature flags: %s", err)
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerListFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+	flags, err := cfg.queries.ListFeatureFlags(r.Context())
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't list feature flags: %w", err))
+		return
+	}
+	if flags == nil {
+		flags = []database.FeatureFlag{}
+	}
+	respondWithJSON(w, http.StatusOK, flags)
+}
+
+func (cfg *apiConfig) handlerSetFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+	reqBody := struct {
+		Enabled *bool `json:"enabled"`
+	}{}
+	name := r.PathValue("name")
+	if !slices.Contains(knownFeatures, name) {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Unknown feature flag %q, known flags are %s", name, strings.Join(knownFeatures, ", ")))
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil || reqBody.Enabled == nil {
+		respondWithError(w, http.StatusBadRequest, "Body must be {\"enabled\": true|false}")
+		return
+	}
+	flag, err := cfg.queries.SetFeatureFlag(r.Context(), database.SetFeatureFlagParams{
+		Name:    name,
+		Enabled: *reqBody.Enabled,
+	})
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't set feature flag: %w", err))
+		return
+	}
+	if err := cfg.loadFeatureFlags(r.Context()); err != nil {
+		log.Printf("failed to reload feature flags: %s", err)
+	}
+	respondWithJSON(w, http.StatusOK, flag)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/auth"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+func TestSetFeatureFlag(t *testing.T) {
+	tests := []struct {
+		name       string
+		flag       string
+		body       string
+		wantStatus int
+		wantStored bool
+	}{
+		{
+			name:       "Known flag",
+			flag:       featureQuotes,
+			body:       `{"enabled":false}`,
+			wantStatus: http.StatusOK,
+			wantStored: true,
+		},
+		{
+			name:       "Unknown flag",
+			flag:       "quote",
+			body:       `{"enabled":false}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Missing enabled",
+			flag:       featureQuotes,
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.adminKey = "admin-secret"
+			req := httptest.NewRequest(http.MethodPut, "/admin/feature-flags/"+tt.flag, strings.NewReader(tt.body))
+			req.SetPathValue("name", tt.flag)
+			req.Header.Set("X-Admin-Key", cfg.adminKey)
+			rec := httptest.NewRecorder()
+			cfg.handlerSetFeatureFlag(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if _, stored := store.flags[tt.flag]; stored != tt.wantStored {
+				t.Errorf("flag stored = %v, want %v", stored, tt.wantStored)
+			}
+			if tt.wantStored && cfg.enabled(tt.flag) {
+				t.Errorf("enabled(%q) = true right after disabling it", tt.flag)
+			}
+		})
+	}
+}
+
+func TestDisabledFeatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		feature string
+		method  string
+		path    string
+		body    string
+		handler func(cfg *apiConfig) http.HandlerFunc
+	}{
+		{
+			name:    "Quotes",
+			feature: featureQuotes,
+			method:  http.MethodPost,
+			path:    "/api/chirps",
+			body:    `{"body":"quoting","quoted_chirp_id":"3311741c-680c-4546-99f3-fc9efac2036c"}`,
+			handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerCreateChirp },
+		},
+		{
+			name:    "Scheduling",
+			feature: featureScheduling,
+			method:  http.MethodPost,
+			path:    "/api/chirps",
+			body:    `{"body":"later","publish_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`,
+			handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerCreateChirp },
+		},
+		{
+			name:    "Export",
+			feature: featureExport,
+			method:  http.MethodGet,
+			path:    "/api/me/export",
+			handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerExportUser },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			userID := store.seedUser("user@example.com")
+			token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+			cfg.featureFlags.set([]database.FeatureFlag{{Name: tt.feature, Enabled: false}})
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			tt.handler(cfg)(rec, req)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), "currently disabled") {
+				t.Errorf("body = %s, want the disabled feature error", rec.Body)
+			}
+			if len(store.committed) != 0 {
+				t.Errorf("committed chirps = %d, want 0", len(store.committed))
+			}
+		})
+	}
+}
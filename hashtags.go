@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+const trendingCacheTTL = 30 * time.Second
+
+// trendingCache briefly remembers trending hashtag results per limit, since
+// the query scans every chirp in the window.
+type trendingCache struct {
+	mu      sync.Mutex
+	entries map[int32]trendingEntry
+}
+
+type trendingEntry struct {
+	rows    []database.GetTrendingHashtagsRow
+	expires time.Time
+}
+
+func (tc *trendingCache) get(limit int32) ([]database.GetTrendingHashtagsRow, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	entry, ok := tc.entries[limit]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.rows, true
+}
+
+func (tc *trendingCache) put(limit int32, rows []database.GetTrendingHashtagsRow) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.entries == nil {
+		tc.entries = make(map[int32]trendingEntry)
+	}
+	tc.entries[limit] = trendingEntry{rows: rows, expires: time.Now().Add(trendingCacheTTL)}
+}
+
+// handlerTrendingHashtags lists the hashtags used most within the trending
+// window. Each use is weighted by how recent it is, so score favours tags
+// that are picking up now over ones that peaked hours ago.
+func (cfg *apiConfig) handlerTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 10, 50)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, ok := cfg.trending.get(limit)
+	if !ok {
+		rows, err = cfg.readQueries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+			WindowSeconds: cfg.trendingWindow.Seconds(),
+			RowLimit:      limit,
+		})
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't get trending hashtags: %w", err))
+			return
+		}
+		cfg.trending.put(limit, rows)
+	}
+	if rows == nil {
+		rows = []database.GetTrendingHashtagsRow{}
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		Hashtags []database.GetTrendingHashtagsRow `json:"hashtags"`
+	}{rows})
+}
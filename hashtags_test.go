@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTrendingHashtags(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		window     time.Duration
+		wantStatus int
+		wantTags   []string
+		wantUses   []int64
+	}{
+		{
+			name:       "Recent uses outrank older, more frequent ones",
+			target:     "/api/hashtags/trending",
+			window:     time.Hour,
+			wantStatus: http.StatusOK,
+			wantTags:   []string{"go", "chirpy", "rust"},
+			wantUses:   []int64{2, 1, 3},
+		},
+		{
+			name:       "Limit",
+			target:     "/api/hashtags/trending?limit=2",
+			window:     time.Hour,
+			wantStatus: http.StatusOK,
+			wantTags:   []string{"go", "chirpy"},
+			wantUses:   []int64{2, 1},
+		},
+		{
+			name:       "Shorter window",
+			target:     "/api/hashtags/trending",
+			window:     10 * time.Minute,
+			wantStatus: http.StatusOK,
+			wantTags:   []string{"go"},
+			wantUses:   []int64{2},
+		},
+		{
+			name:       "Invalid limit",
+			target:     "/api/hashtags/trending?limit=zero",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.trendingWindow = tt.window
+			author := store.seedUser("user@example.com")
+			inactive := store.seedUser("inactive@example.com")
+			store.users[inactive.String()][6] = false
+			now := time.Now()
+			store.seed(author, "learning #Go today #go", now.Add(-5*time.Minute))
+			store.seed(author, "hello #chirpy", now.Add(-20*time.Minute))
+			for range 3 {
+				store.seed(author, "still on #rust", now.Add(-50*time.Minute))
+			}
+			store.seed(author, "ancient #history", now.Add(-2*time.Hour))
+			store.seed(inactive, "quiet #gone", now)
+			scheduled := store.seed(author, "coming #soon", now)
+			store.committed[scheduled.String()][7] = now.Add(time.Hour)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerTrendingHashtags(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var res struct {
+				Hashtags []struct {
+					Tag  string `json:"tag"`
+					Uses int64  `json:"uses"`
+				} `json:"hashtags"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatalf("couldn't decode response: %v", err)
+			}
+			var tags []string
+			var uses []int64
+			for _, h := range res.Hashtags {
+				tags = append(tags, h.Tag)
+				uses = append(uses, h.Uses)
+			}
+			if !slices.Equal(tags, tt.wantTags) || !slices.Equal(uses, tt.wantUses) {
+				t.Errorf("hashtags = %v with uses %v, want %v with uses %v", tags, uses, tt.wantTags, tt.wantUses)
+			}
+		})
+	}
+}
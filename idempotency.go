@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+const idempotencyCleanupInterval = 10 * time.Minute
+
+// errIdempotencyKeyTaken means another request stored the same idempotency
+// key first, so this request's chirp must not be committed.
+var errIdempotencyKeyTaken = errors.New("idempotency key already used")
+
+// respondIdempotentChirp answers a repeated create with the chirp stored
+// under its idempotency key.
+func (cfg *apiConfig) respondIdempotentChirp(w http.ResponseWriter, r *http.Request, stored database.IdempotencyKey) {
+	chirp, err := cfg.queries.GetChirpByID(r.Context(), stored.ChirpID)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't load idempotent chirp: %w", err))
+		return
+	}
+	res, err := cfg.chirpResponse(r.Context(), chirp)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't load quoted chirp: %w", err))
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, res)
+}
+
+// cleanupIdempotencyKeys periodically deletes idempotency keys whose TTL has
+// passed. It runs for the lifetime of the process.
+func (cfg *apiConfig) cleanupIdempotencyKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := cfg.queries.DeleteExpiredIdempotencyKeys(context.Background())
+		if err != nil {
+			log.Printf("failed to delete expired idempotency keys: %s", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("deleted %d expired idempotency keys", n)
+		}
+	}
+}
@@ -14,23 +14,47 @@ import (
 )
 
 func HashPassword(password string) (string, error) {
-	s, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(s), err
+	return BcryptHasher{Cost: bcrypt.DefaultCost}.Hash(password)
 }
 
+// CheckPasswordHash verifies password against hash, dispatching on the
+// algorithm prefix stored in the hash.
 func CheckPasswordHash(hash, password string) error {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		return checkArgon2idHash(hash, password)
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+// ChirpyClaims are the claims carried by Chirpy access tokens. Custom
+// fields are hints for clients and must not be trusted for authorization
+// without checking the database.
+type ChirpyClaims struct {
+	jwt.RegisteredClaims
+	IsChirpyRed bool `json:"chirpy_red,omitempty"`
+}
+
+// NewClaims returns the standard claims for an access token for userID,
+// with a unique token ID.
+func NewClaims(userID uuid.UUID, expiresIn time.Duration) ChirpyClaims {
+	now := time.Now().UTC()
+	return ChirpyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
 	}
+}
+
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return SignClaims(NewClaims(userID, expiresIn), tokenSecret)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+func SignClaims(claims ChirpyClaims, tokenSecret string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
 	sig, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
 		return "", err
@@ -38,17 +62,28 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return sig, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// DefaultLeeway is the clock skew tolerated when validating a JWT's time
+// based claims.
+const DefaultLeeway = 30 * time.Second
+
+func ValidateJWT(tokenString, tokenSecret string, leeway time.Duration) (uuid.UUID, error) {
+	claims, err := ParseClaims(tokenString, tokenSecret, leeway)
 	if err != nil {
 		return uuid.UUID{}, err
-	} else if subj, ok := token.Claims.GetSubject(); ok == nil {
-		return uuid.Parse(subj)
-	} else {
-		return uuid.UUID{}, ok
 	}
+	return uuid.Parse(claims.Subject)
+}
+
+// ParseClaims verifies tokenString and returns its claims.
+func ParseClaims(tokenString, tokenSecret string, leeway time.Duration) (*ChirpyClaims, error) {
+	claims := &ChirpyClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithLeeway(leeway), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
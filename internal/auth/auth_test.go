@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -63,6 +64,95 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func TestCheckPasswordHashAcrossAlgorithms(t *testing.T) {
+	password := "correctPassword123!"
+	bcryptHasher, err := NewPasswordHasher("bcrypt")
+	if err != nil {
+		t.Fatalf("NewPasswordHasher(bcrypt) error: %s", err)
+	}
+	argonHasher, err := NewPasswordHasher("argon2id")
+	if err != nil {
+		t.Fatalf("NewPasswordHasher(argon2id) error: %s", err)
+	}
+	bcryptHash, _ := bcryptHasher.Hash(password)
+	argonHash, _ := argonHasher.Hash(password)
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		wantErr  bool
+	}{
+		{
+			name:     "bcrypt hash",
+			password: password,
+			hash:     bcryptHash,
+			wantErr:  false,
+		},
+		{
+			name:     "argon2id hash",
+			password: password,
+			hash:     argonHash,
+			wantErr:  false,
+		},
+		{
+			name:     "argon2id wrong password",
+			password: "wrongPassword",
+			hash:     argonHash,
+			wantErr:  true,
+		},
+		{
+			name:     "Malformed argon2id hash",
+			password: password,
+			hash:     "$argon2id$v=19$m=65536,t=1$bad",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPasswordHash(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckPasswordHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewPasswordHasher("md5"); err == nil {
+		t.Errorf("NewPasswordHasher(md5) error = nil, want unknown algorithm")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	password := "correctPassword123!"
+	current := BcryptHasher{Cost: 10}
+	weak, _ := BcryptHasher{Cost: 4}.Hash(password)
+	argonHash, _ := DefaultArgon2idHasher.Hash(password)
+
+	if !current.NeedsRehash(weak) {
+		t.Errorf("NeedsRehash() = false for low-cost bcrypt hash, want true")
+	}
+	upgraded, err := current.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error: %s", err)
+	}
+	if current.NeedsRehash(upgraded) {
+		t.Errorf("NeedsRehash() = true after rehashing, want false")
+	}
+	if err := CheckPasswordHash(upgraded, password); err != nil {
+		t.Errorf("upgraded hash doesn't verify: %s", err)
+	}
+	if !current.NeedsRehash(argonHash) {
+		t.Errorf("NeedsRehash() = false for argon2id hash under bcrypt, want true")
+	}
+	if DefaultArgon2idHasher.NeedsRehash(argonHash) {
+		t.Errorf("NeedsRehash() = true for current argon2id hash, want false")
+	}
+	if !DefaultArgon2idHasher.NeedsRehash(upgraded) {
+		t.Errorf("NeedsRehash() = false for bcrypt hash under argon2id, want true")
+	}
+}
+
 func TestCheckJWT(t *testing.T) {
 	secret := "Dw/G:+@%VR[a$LV,D4L{5+(4I}+zf+ER"
 	userid := uuid.New()
@@ -70,7 +160,7 @@ func TestCheckJWT(t *testing.T) {
 	if err != nil {
 		t.Errorf("MakeJWT error: %s", err)
 	}
-	id, err := ValidateJWT(jwt1, secret)
+	id, err := ValidateJWT(jwt1, secret, 0)
 	if err != nil {
 		t.Errorf("ValidateJWT error: %s", err)
 	}
@@ -80,6 +170,125 @@ func TestCheckJWT(t *testing.T) {
 
 }
 
+func TestChirpyClaimsRoundTrip(t *testing.T) {
+	secret := "Dw/G:+@%VR[a$LV,D4L{5+(4I}+zf+ER"
+	userid := uuid.New()
+
+	tests := []struct {
+		name   string
+		claims ChirpyClaims
+	}{
+		{
+			name:   "Default claims",
+			claims: NewClaims(userid, time.Hour),
+		},
+		{
+			name: "Chirpy Red hint",
+			claims: func() ChirpyClaims {
+				c := NewClaims(userid, time.Hour)
+				c.IsChirpyRed = true
+				return c
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := SignClaims(tt.claims, secret)
+			if err != nil {
+				t.Fatalf("SignClaims() error = %v", err)
+			}
+			got, err := ParseClaims(token, secret, 0)
+			if err != nil {
+				t.Fatalf("ParseClaims() error = %v", err)
+			}
+			if got.ID == "" || got.ID != tt.claims.ID {
+				t.Errorf("ID = %q, want %q", got.ID, tt.claims.ID)
+			}
+			if got.Subject != userid.String() {
+				t.Errorf("Subject = %q, want %q", got.Subject, userid)
+			}
+			if got.IsChirpyRed != tt.claims.IsChirpyRed {
+				t.Errorf("IsChirpyRed = %v, want %v", got.IsChirpyRed, tt.claims.IsChirpyRed)
+			}
+		})
+	}
+
+	a, b := NewClaims(userid, time.Hour), NewClaims(userid, time.Hour)
+	if a.ID == b.ID {
+		t.Errorf("NewClaims() reused token ID %q", a.ID)
+	}
+}
+
+func TestValidateJWTLeeway(t *testing.T) {
+	secret := "Dw/G:+@%VR[a$LV,D4L{5+(4I}+zf+ER"
+	userid := uuid.New()
+	now := time.Now().UTC()
+	sign := func(issuedAt, expiresAt time.Time) string {
+		claims := &jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Subject:   userid.String(),
+		}
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("failed to sign token: %s", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		leeway  time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "Just expired without leeway",
+			token:   sign(now.Add(-time.Hour), now.Add(-10*time.Second)),
+			leeway:  0,
+			wantErr: true,
+		},
+		{
+			name:    "Just expired within leeway",
+			token:   sign(now.Add(-time.Hour), now.Add(-10*time.Second)),
+			leeway:  DefaultLeeway,
+			wantErr: false,
+		},
+		{
+			name:    "Expired beyond leeway",
+			token:   sign(now.Add(-time.Hour), now.Add(-time.Minute)),
+			leeway:  DefaultLeeway,
+			wantErr: true,
+		},
+		{
+			name:    "Issued in the future without leeway",
+			token:   sign(now.Add(10*time.Second), now.Add(time.Hour)),
+			leeway:  0,
+			wantErr: true,
+		},
+		{
+			name:    "Issued in the future within leeway",
+			token:   sign(now.Add(10*time.Second), now.Add(time.Hour)),
+			leeway:  DefaultLeeway,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ValidateJWT(tt.token, secret, tt.leeway)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && id != userid {
+				t.Errorf("UUIDs don't match:\nog: %v\nto: %v\n", userid, id)
+			}
+		})
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
 	tokenString := "myTokenString"
 	jwt1 := "Bearer " + tokenString
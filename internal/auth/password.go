@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords with a specific algorithm. Hashes are
+// self-describing, so CheckPasswordHash can verify any of them regardless of
+// which hasher is currently configured.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether hash was produced by a different algorithm
+	// or with weaker parameters than this hasher uses.
+	NeedsRehash(hash string) bool
+}
+
+// NewPasswordHasher returns the hasher for algo, which is "bcrypt" or
+// "argon2id". An empty algo selects bcrypt.
+func NewPasswordHasher(algo string) (PasswordHasher, error) {
+	switch algo {
+	case "", "bcrypt":
+		return BcryptHasher{Cost: bcrypt.DefaultCost}, nil
+	case "argon2id":
+		return DefaultArgon2idHasher, nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algo)
+	}
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	s, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(s), err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost < h.Cost
+}
+
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+}
+
+var DefaultArgon2idHasher = Argon2idHasher{
+	Time:    1,
+	Memory:  64 * 1024,
+	Threads: 4,
+	KeyLen:  32,
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var errInvalidArgon2idHash = errors.New("invalid argon2id hash")
+
+// Hash returns the password hash in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	stored, _, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+	return stored.Time < h.Time || stored.Memory < h.Memory ||
+		stored.Threads < h.Threads || uint32(len(key)) < h.KeyLen
+}
+
+// parseArgon2idHash splits a PHC-formatted argon2id hash into its parameters,
+// salt and key.
+func parseArgon2idHash(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var h Argon2idHasher
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return h, nil, nil, errInvalidArgon2idHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, nil, nil, errInvalidArgon2idHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Time, &h.Threads); err != nil {
+		return h, nil, nil, errInvalidArgon2idHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return h, nil, nil, errInvalidArgon2idHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return h, nil, nil, errInvalidArgon2idHash
+	}
+	h.KeyLen = uint32(len(key))
+	return h, salt, key, nil
+}
+
+func checkArgon2idHash(hash, password string) error {
+	h, salt, want, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+	got := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return errors.New("argon2id: password does not match hash")
+	}
+	return nil
+}
@@ -7,29 +7,44 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at
 `
 
 type CreateChirpParams struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body          string        `json:"body"`
+	UserID        uuid.UUID     `json:"user_id"`
+	IsSensitive   bool          `json:"is_sensitive"`
+	QuotedChirpID uuid.NullUUID `json:"quoted_chirp_id"`
+	PublishAt     sql.NullTime  `json:"publish_at"`
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.IsSensitive,
+		arg.QuotedChirpID,
+		arg.PublishAt,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,17 +52,23 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.IsSensitive,
+		&i.QuotedChirpID,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
-const deleteAllChirps = `-- name: DeleteAllChirps :exec
+const deleteAllChirps = `-- name: DeleteAllChirps :execrows
 DELETE FROM chirps *
 `
 
-func (q *Queries) DeleteAllChirps(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteAllChirps)
-	return err
+func (q *Queries) DeleteAllChirps(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAllChirps)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
@@ -60,8 +81,20 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteChirpsByUser = `-- name: DeleteChirpsByUser :exec
+DELETE FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteChirpsByUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirpsByUser, userID)
+	return err
+}
+
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
 ORDER BY created_at ASC
 `
 
@@ -80,6 +113,9 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -95,7 +131,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
 WHERE id = $1
 `
 
@@ -108,13 +144,17 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.IsSensitive,
+		&i.QuotedChirpID,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE user_id = $1 AND (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
 ORDER BY created_at ASC
 `
 
@@ -133,6 +173,255 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByAuthorPage = `-- name: GetChirpsByAuthorPage :many
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE user_id = $1
+  AND (created_at, id) > ($2::timestamptz, $3::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type GetChirpsByAuthorPageParams struct {
+	UserID         uuid.UUID `json:"user_id"`
+	AfterCreatedAt time.Time `json:"after_created_at"`
+	AfterID        uuid.UUID `json:"after_id"`
+	RowLimit       int32     `json:"row_limit"`
+}
+
+func (q *Queries) GetChirpsByAuthorPage(ctx context.Context, arg GetChirpsByAuthorPageParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorPage,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE id = ANY($1::uuid[])
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPaginated = `-- name: GetChirpsPaginated :many
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+  AND ($1::uuid IS NULL OR user_id = $1)
+  AND (NOT $2::bool OR NOT is_sensitive)
+  AND ($3::timestamptz IS NULL
+    OR (created_at, id) > ($3, $4::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type GetChirpsPaginatedParams struct {
+	AuthorID         uuid.NullUUID `json:"author_id"`
+	ExcludeSensitive bool          `json:"exclude_sensitive"`
+	AfterCreatedAt   sql.NullTime  `json:"after_created_at"`
+	AfterID          uuid.NullUUID `json:"after_id"`
+	RowLimit         int32         `json:"row_limit"`
+}
+
+func (q *Queries) GetChirpsPaginated(ctx context.Context, arg GetChirpsPaginatedParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPaginated,
+		arg.AuthorID,
+		arg.ExcludeSensitive,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedChirps = `-- name: GetFeedChirps :many
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+  AND ($1::uuid IS NULL OR user_id = $1)
+  AND (NOT $2::bool OR NOT is_sensitive)
+  AND ($3::timestamptz IS NULL
+    OR (created_at, id) < ($3, $4::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type GetFeedChirpsParams struct {
+	AuthorID         uuid.NullUUID `json:"author_id"`
+	ExcludeSensitive bool          `json:"exclude_sensitive"`
+	BeforeCreatedAt  sql.NullTime  `json:"before_created_at"`
+	BeforeID         uuid.NullUUID `json:"before_id"`
+	RowLimit         int32         `json:"row_limit"`
+}
+
+func (q *Queries) GetFeedChirps(ctx context.Context, arg GetFeedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedChirps,
+		arg.AuthorID,
+		arg.ExcludeSensitive,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentChirps = `-- name: GetRecentChirps :many
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+ORDER BY created_at DESC
+LIMIT $1
+`
+
+func (q *Queries) GetRecentChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -146,3 +435,122 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const getRecentChirpsByAuthor = `-- name: GetRecentChirpsByAuthor :many
+SELECT id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at FROM chirps
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type GetRecentChirpsByAuthorParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	RowLimit int32     `json:"row_limit"`
+}
+
+func (q *Queries) GetRecentChirpsByAuthor(ctx context.Context, arg GetRecentChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentChirpsByAuthor, arg.UserID, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.IsSensitive,
+			&i.QuotedChirpID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrendingHashtags = `-- name: GetTrendingHashtags :many
+SELECT LOWER(m[2])::text AS tag,
+       COUNT(*) AS uses,
+       SUM(1 - EXTRACT(EPOCH FROM NOW() - COALESCE(chirps.publish_at, chirps.created_at)) / $1::float8)::float8 AS score
+FROM chirps, regexp_matches(chirps.body, '(^|\s)#([[:alnum:]_]+)', 'g') AS m
+WHERE COALESCE(chirps.publish_at, chirps.created_at) > NOW() - make_interval(secs => $1)
+  AND COALESCE(chirps.publish_at, chirps.created_at) <= NOW()
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+GROUP BY tag
+ORDER BY score DESC, tag ASC
+LIMIT $2
+`
+
+type GetTrendingHashtagsParams struct {
+	WindowSeconds float64 `json:"window_seconds"`
+	RowLimit      int32   `json:"row_limit"`
+}
+
+type GetTrendingHashtagsRow struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+func (q *Queries) GetTrendingHashtags(ctx context.Context, arg GetTrendingHashtagsParams) ([]GetTrendingHashtagsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTrendingHashtags, arg.WindowSeconds, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTrendingHashtagsRow
+	for rows.Next() {
+		var i GetTrendingHashtagsRow
+		if err := rows.Scan(&i.Tag, &i.Uses, &i.Score); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at
+`
+
+type UpdateChirpParams struct {
+	Body string    `json:"body"`
+	ID   uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.IsSensitive,
+		&i.QuotedChirpID,
+		&i.PublishAt,
+	)
+	return i, err
+}
@@ -11,12 +11,46 @@ import (
 	"github.com/google/uuid"
 )
 
+type AuditLog struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	ActorID   uuid.NullUUID `json:"actor_id"`
+	Action    string        `json:"action"`
+	TargetID  uuid.NullUUID `json:"target_id"`
+	Ip        string        `json:"ip"`
+}
+
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            uuid.UUID     `json:"id"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	Body          string        `json:"body"`
+	UserID        uuid.UUID     `json:"user_id"`
+	IsSensitive   bool          `json:"is_sensitive"`
+	QuotedChirpID uuid.NullUUID `json:"quoted_chirp_id"`
+	PublishAt     sql.NullTime  `json:"publish_at"`
+}
+
+type FeatureFlag struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
 	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
+}
+
+type IdempotencyKey struct {
+	Key       string    `json:"key"`
 	UserID    uuid.UUID `json:"user_id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PasswordResetToken struct {
+	Token     string       `json:"token"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
 }
 
 type RefreshToken struct {
@@ -35,4 +69,5 @@ type User struct {
 	Email          string    `json:"email"`
 	HashedPassword string    `json:"hashed_password"`
 	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	IsActive       bool      `json:"is_active"`
 }
@@ -44,12 +44,25 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 	return i, err
 }
 
-const deleteAllRefreshTokens = `-- name: DeleteAllRefreshTokens :exec
+const deleteAllRefreshTokens = `-- name: DeleteAllRefreshTokens :execrows
 DELETE FROM refresh_tokens *
 `
 
-func (q *Queries) DeleteAllRefreshTokens(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteAllRefreshTokens)
+func (q *Queries) DeleteAllRefreshTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAllRefreshTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRefreshTokensForUser = `-- name: DeleteRefreshTokensForUser :exec
+DELETE FROM refresh_tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRefreshTokensForUser, userID)
 	return err
 }
 
@@ -72,6 +85,73 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 	return i, err
 }
 
+const listRefreshTokens = `-- name: ListRefreshTokens :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens
+WHERE ($1::uuid IS NULL OR user_id = $1)
+  AND ($2::text = 'all'
+    OR ($2 = 'active' AND revoked_at IS NULL AND expires_at > NOW())
+    OR ($2 = 'revoked' AND revoked_at IS NOT NULL)
+    OR ($2 = 'expired' AND revoked_at IS NULL AND expires_at <= NOW()))
+ORDER BY created_at DESC
+LIMIT $3 OFFSET $4
+`
+
+type ListRefreshTokensParams struct {
+	UserID    uuid.NullUUID `json:"user_id"`
+	State     string        `json:"state"`
+	RowLimit  int32         `json:"row_limit"`
+	RowOffset int32         `json:"row_offset"`
+}
+
+func (q *Queries) ListRefreshTokens(ctx context.Context, arg ListRefreshTokensParams) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshTokens,
+		arg.UserID,
+		arg.State,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const revokeToken = `-- name: RevokeToken :one
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
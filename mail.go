@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+)
+
+// mailer delivers messages to users outside the API, so secrets such as
+// password reset tokens never appear in a response.
+type mailer interface {
+	SendPasswordReset(ctx context.Context, to, token string) error
+}
+
+// smtpMailer sends mail through the SMTP server at addr.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// mailerFromEnv returns an SMTP mailer when SMTP_ADDR is set. Without it,
+// dev platforms log messages instead and other platforms send nothing.
+func mailerFromEnv(platform string) mailer {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		if platform == "dev" {
+			return logMailer{}
+		}
+		return nil
+	}
+	m := smtpMailer{addr: addr, from: os.Getenv("SMTP_FROM")}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+func (m smtpMailer) SendPasswordReset(ctx context.Context, to, token string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Reset your Chirpy password\r\n\r\n"+
+		"Use this token to set a new password within %s:\r\n\r\n%s\r\n\r\n"+
+		"If you didn't ask for a reset, you can ignore this email.\r\n",
+		m.from, to, passwordResetTTL, token)
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg))
+}
+
+// logMailer writes messages to the server log, for local development.
+type logMailer struct{}
+
+func (logMailer) SendPasswordReset(ctx context.Context, to, token string) error {
+	log.Printf("password reset for %s: token %s", to, token)
+	return nil
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,19 +29,42 @@ import (
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	routeHits      routeHits
+	db             *sql.DB
 	queries        *database.Queries
+	readQueries    *database.Queries
 	platform       string
 	secret         string
 	polka_key      string
-}
+	adminKey       string
+	idempotencyTTL time.Duration
+	jwtLeeway      time.Duration
+	jwtExpiry      time.Duration
 
-type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	Password    string    `json:"-"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	contentSecurityPolicy string
+	bannedEmails          map[string]struct{}
+	bannedDomains         map[string]struct{}
+	trustedProxies        map[string]struct{}
+	sessionLimiter        *rateLimiter
+	mailer                mailer
+	welcomeChirp          string
+	passwordHasher        auth.PasswordHasher
+	dummyHashOnce         sync.Once
+	dummyHash             string
+	sanitizeChirps        bool
+	maxEmailLength        int
+	webhookNonces         *nonceStore
+	webhookMaxBytes       int64
+	polkaAllowAPIKey      bool
+	checkUserExists       bool
+	trendingWindow        time.Duration
+	truncateLongChirps    bool
+	profanityMode         string
+	profaneWords          map[string]struct{}
+	slowQueryThreshold    time.Duration
+	trending              trendingCache
+	normalizeProfanity    bool
+	featureFlags          featureFlags
 }
 
 func main() {
@@ -43,39 +74,255 @@ func main() {
 	if err != nil {
 		log.Fatal("failed to open db connection")
 	}
+	// Read-only public endpoints go to the replica when one is configured.
+	// Anything that must see its own writes keeps using the primary.
+	replica := db
+	if replicaURL := os.Getenv("DB_URL_REPLICA"); replicaURL != "" {
+		replica, err = sql.Open("postgres", replicaURL)
+		if err != nil {
+			log.Fatal("failed to open replica db connection")
+		}
+	}
 	const filepathRoot = "."
 	const port = "8080"
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
-		queries:        database.New(db),
+		db:             db,
 		platform:       os.Getenv("PLATFORM"),
 		secret:         os.Getenv("SECRET"),
 		polka_key:      os.Getenv("POLKA_KEY"),
+		adminKey:       os.Getenv("ADMIN_KEY"),
+		idempotencyTTL: envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		jwtLeeway:      envDuration("JWT_LEEWAY", auth.DefaultLeeway),
+		jwtExpiry:      envDuration("JWT_EXPIRY", time.Hour),
+
+		contentSecurityPolicy: os.Getenv("CONTENT_SECURITY_POLICY"),
+		bannedEmails:          envSet("BANNED_EMAILS"),
+		bannedDomains:         envSet("BANNED_DOMAINS"),
+		trustedProxies:        envSet("TRUSTED_PROXIES"),
+		welcomeChirp:          os.Getenv("WELCOME_CHIRP"),
+		sanitizeChirps:        os.Getenv("SANITIZE_CHIRPS") == "true",
+		maxEmailLength:        envInt("MAX_EMAIL_LENGTH", 254),
+		webhookMaxBytes:       int64(envInt("WEBHOOK_MAX_BYTES", 4096)),
+		polkaAllowAPIKey:      os.Getenv("POLKA_ALLOW_API_KEY") == "true",
+		checkUserExists:       os.Getenv("AUTH_CHECK_USER_EXISTS") != "false",
+		trendingWindow:        envDuration("TRENDING_WINDOW", 24*time.Hour),
+		truncateLongChirps:    os.Getenv("TRUNCATE_LONG_CHIRPS") == "true",
+		profanityMode:         os.Getenv("PROFANITY_MODE"),
+		normalizeProfanity:    os.Getenv("PROFANITY_NORMALIZE") != "false",
+		slowQueryThreshold:    time.Duration(envInt("SLOW_QUERY_MS", 0)) * time.Millisecond,
+	}
+	apiCfg.queries = apiCfg.newQueries(db)
+	apiCfg.readQueries = apiCfg.newQueries(replica)
+	apiCfg.passwordHasher, err = auth.NewPasswordHasher(os.Getenv("PASSWORD_HASH_ALGO"))
+	if err != nil {
+		log.Fatalf("invalid PASSWORD_HASH_ALGO: %s", err)
+	}
+	apiCfg.dummyPasswordHash()
+	trailingSlash := os.Getenv("TRAILING_SLASH")
+	if trailingSlash == "" {
+		trailingSlash = "rewrite"
+	}
+	if trailingSlash != "rewrite" && trailingSlash != "redirect" {
+		log.Fatalf("invalid TRAILING_SLASH %q: must be rewrite or redirect", trailingSlash)
+	}
+	if apiCfg.profanityMode == "" {
+		apiCfg.profanityMode = "mask"
+	}
+	if apiCfg.profanityMode != "mask" && apiCfg.profanityMode != "reject" {
+		log.Fatalf("invalid PROFANITY_MODE %q: must be mask or reject", apiCfg.profanityMode)
+	}
+	apiCfg.profaneWords = profaneWordsFromEnv(apiCfg.normalizeProfanity)
+	deprecatedRoutes, err := parseDeprecatedRoutes(os.Getenv("DEPRECATED_ROUTES"))
+	if err != nil {
+		log.Fatalf("invalid DEPRECATED_ROUTES: %s", err)
+	}
+	if err := apiCfg.prepareWelcomeChirp(); err != nil {
+		log.Fatalf("invalid WELCOME_CHIRP: %s", err)
+	}
+	rootMode := os.Getenv("ROOT_RESPONSE")
+	if rootMode == "" {
+		rootMode = "redirect"
+	}
+	if rootMode != "redirect" && rootMode != "json" {
+		log.Fatalf("invalid ROOT_RESPONSE %q: must be redirect or json", rootMode)
+	}
+	corsOrigin := os.Getenv("CORS_ORIGIN")
+	if corsOrigin == "" {
+		corsOrigin = "*"
+	}
+	if apiCfg.contentSecurityPolicy == "" {
+		apiCfg.contentSecurityPolicy = "default-src 'self'"
+	}
+	if limit := envInt("SESSION_LIMIT_PER_IP", 0); limit > 0 {
+		apiCfg.sessionLimiter = newRateLimiter(limit, envDuration("SESSION_LIMIT_WINDOW", time.Hour))
 	}
+	// Login and reactivate both check passwords, so they share one
+	// brute-force budget per client IP.
+	var loginLimiter *rateLimiter
+	if limit := envInt("LOGIN_LIMIT_PER_IP", 5); limit > 0 {
+		loginLimiter = newRateLimiter(limit, envDuration("LOGIN_LIMIT_WINDOW", time.Minute))
+	}
+	loginLimit := apiCfg.middlewareRateLimit(loginLimiter)
+	var resetLimiter *rateLimiter
+	if limit := envInt("RESET_LIMIT_PER_IP", 5); limit > 0 {
+		resetLimiter = newRateLimiter(limit, envDuration("RESET_LIMIT_WINDOW", time.Hour))
+	}
+	apiCfg.mailer = mailerFromEnv(apiCfg.platform)
+	if window := envDuration("POLKA_REPLAY_WINDOW", 0); window > 0 {
+		apiCfg.webhookNonces = newNonceStore(window)
+	}
+	if err := apiCfg.loadFeatureFlags(context.Background()); err != nil {
+		log.Printf("failed to load feature flags, all features enabled: %s", err)
+	}
+	go apiCfg.refreshFeatureFlags(envDuration("FEATURE_FLAGS_REFRESH", 30*time.Second))
+	apiCfg.validate()
+	go apiCfg.cleanupIdempotencyKeys(idempotencyCleanupInterval)
 
 	mux := http.NewServeMux()
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
+	mux.Handle("/app/", chain(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))),
+		apiCfg.middlewareMetricsInc,
+		apiCfg.middlewareCSP,
+	))
+	// {$} matches only "/" itself, so /app/, /api/ and /admin/ are unaffected.
+	mux.HandleFunc("GET /{$}", handlerRoot(rootMode))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /api/healthz/db", apiCfg.handlerDBHealth)
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.Handle("POST /api/login", chain(http.HandlerFunc(apiCfg.handlerLogin), loginLimit))
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.HandleFunc("POST /api/revoke-all", apiCfg.handlerRevokeAll)
+	mux.Handle("POST /api/password-reset/request", chain(http.HandlerFunc(apiCfg.handlerRequestPasswordReset),
+		apiCfg.middlewareRateLimit(resetLimiter)))
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.handlerConfirmPasswordReset)
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
+	mux.HandleFunc("GET /api/chirps/recent", apiCfg.handlerGetRecentChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetChirpByID)
+	mux.HandleFunc("GET /api/feed", apiCfg.handlerGetFeed)
+	mux.HandleFunc("GET /api/hashtags/trending", apiCfg.handlerTrendingHashtags)
+	mux.HandleFunc("GET /api/users/{userID}", apiCfg.handlerGetUserByID)
+	mux.HandleFunc("GET /api/users/{userID}/chirps", apiCfg.handlerGetUserChirps)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerUpdateChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	mux.HandleFunc("GET /admin/metrics.json", apiCfg.handlerMetricsJSON)
+	mux.HandleFunc("GET /admin/metrics/api", apiCfg.handlerRouteMetrics)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /admin/health/detail", apiCfg.handlerHealthDetail)
+	mux.HandleFunc("GET /admin/refresh-tokens", apiCfg.handlerListRefreshTokens)
+	mux.HandleFunc("POST /admin/users/upgrade", apiCfg.handlerBulkUpgradeUsers)
+	mux.HandleFunc("POST /admin/users/{userID}/revoke-sessions", apiCfg.handlerRevokeUserSessions)
+	mux.HandleFunc("GET /admin/audit-log", apiCfg.handlerListAuditLog)
+	mux.HandleFunc("GET /admin/feature-flags", apiCfg.handlerListFeatureFlags)
+	mux.HandleFunc("PUT /admin/feature-flags/{name}", apiCfg.handlerSetFeatureFlag)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsers)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeUser)
+	mux.HandleFunc("DELETE /api/users", apiCfg.handlerDeleteUser)
+	mux.HandleFunc("GET /api/me/export", apiCfg.handlerExportUser)
+	mux.HandleFunc("POST /api/me/deactivate", apiCfg.handlerDeactivate)
+	mux.Handle("POST /api/reactivate", chain(http.HandlerFunc(apiCfg.handlerReactivate), loginLimit))
+	mux.Handle("POST /api/polka/webhooks", chain(http.HandlerFunc(apiCfg.handlerUpgradeUser),
+		middlewareMaxBytes(apiCfg.webhookMaxBytes),
+	))
+
+	for _, pattern := range unknownRoutes(mux, deprecatedRoutes) {
+		log.Printf("warning: DEPRECATED_ROUTES names %q, which isn't a registered route", pattern)
+	}
+
+	// Global middleware, outermost first. CORS comes before the concurrency
+	// limit so browsers can read a 503, and trailing slashes are normalized
+	// before the deprecation lookup so both see the same route.
+	handler := chain(middlewareDeprecation(mux, deprecatedRoutes),
+		middlewareRequestID,
+		middlewareCORS(corsOrigin),
+		middlewareConcurrencyLimit(envInt("MAX_CONCURRENT_REQUESTS", 0), envDuration("MAX_CONCURRENT_WAIT", 100*time.Millisecond)),
+		middlewareUserCache,
+		middlewareTrailingSlash(trailingSlash),
+		apiCfg.middlewareRouteHits,
+	)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: handler,
 	}
 
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(srv.ListenAndServe())
+	tlsConfig, err := tlsConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %s", err)
+	}
+	serve := srv.ListenAndServe
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+		// The key pair is already loaded into tlsConfig.
+		serve = func() error { return srv.ListenAndServeTLS("", "") }
+		log.Printf("Serving files from %s on port: %s (TLS)\n", filepathRoot, port)
+	} else {
+		log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- serve() }()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Printf("received %s, shutting down (waiting up to %s for in-flight requests)", sig, shutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown timed out, dropping remaining connections: %s", err)
+	} else {
+		log.Printf("all requests finished")
+	}
+	if replica != db {
+		replica.Close()
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("failed to close database: %s", err)
+	}
+	log.Printf("database closed, exiting")
+}
+
+// shutdownTimeout is how long a SIGINT or SIGTERM waits for in-flight
+// requests before the server exits anyway.
+const shutdownTimeout = 30 * time.Second
+
+// validate logs configuration that disables or weakens features at startup.
+// An unset POLKA_KEY disables the Polka webhook and an unset ADMIN_KEY the
+// admin endpoints: they respond 503 rather than comparing against an empty
+// key.
+func (cfg *apiConfig) validate() {
+	if cfg.polka_key == "" {
+		log.Printf("warning: POLKA_KEY is not set, Polka webhooks are disabled")
+	} else if cfg.polkaAllowAPIKey {
+		log.Printf("warning: POLKA_ALLOW_API_KEY is set, unsigned Polka webhooks are accepted")
+	}
+	if cfg.adminKey == "" {
+		log.Printf("warning: ADMIN_KEY is not set, admin endpoints are disabled")
+	}
+	if cfg.mailer == nil {
+		log.Printf("warning: SMTP_ADDR is not set, password reset emails are not sent")
+	}
+}
+
+// isBanned reports whether email or its domain is on the configured ban list.
+func (cfg *apiConfig) isBanned(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if _, ok := cfg.bannedEmails[email]; ok {
+		return true
+	}
+	if at := strings.LastIndex(email, "@"); at != -1 {
+		if _, ok := cfg.bannedDomains[email[at+1:]]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 func handlerReadiness(w http.ResponseWriter, r *http.Request) {
@@ -84,6 +331,43 @@ func handlerReadiness(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(http.StatusText(http.StatusOK)))
 }
 
+// dbPingTimeout bounds the database check in GET /api/healthz/db.
+const dbPingTimeout = 2 * time.Second
+
+// handlerDBHealth reports whether the primary database answers a ping, so
+// load balancers can take an instance out of rotation when it can't reach
+// Postgres.
+func (cfg *apiConfig) handlerDBHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dbPingTimeout)
+	defer cancel()
+	if err := cfg.db.PingContext(ctx); err != nil {
+		log.Printf("database health check failed (request %s): %s", requestID(r), err)
+		respondWithJSON(w, http.StatusServiceUnavailable, struct {
+			Status string `json:"status"`
+		}{"unavailable"})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{"ok"})
+}
+
+// handlerRoot answers requests for "/" by redirecting to the web app, or
+// with a short JSON description of the service in mode "json".
+func handlerRoot(mode string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mode == "redirect" {
+			http.Redirect(w, r, "/app/", http.StatusFound)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, struct {
+			Service string `json:"service"`
+			App     string `json:"app"`
+			Health  string `json:"health"`
+		}{"chirpy", "/app/", "/api/healthz"})
+	}
+}
+
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -96,113 +380,282 @@ func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(htmlContent))
 }
 
+func (cfg *apiConfig) handlerHealthDetail(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+	stats := cfg.db.Stats()
+	respondWithJSON(w, http.StatusOK, struct {
+		MaxOpenConnections int    `json:"max_open_connections"`
+		OpenConnections    int    `json:"open_connections"`
+		InUse              int    `json:"in_use"`
+		Idle               int    `json:"idle"`
+		WaitCount          int64  `json:"wait_count"`
+		WaitDuration       string `json:"wait_duration"`
+		MaxIdleClosed      int64  `json:"max_idle_closed"`
+		MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+	}{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	})
+}
+
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
 		respondWithError(w, http.StatusForbidden, "not allowed")
 		return
 	}
-	err := cfg.queries.DeleteAllUsers(r.Context())
-	if err != nil {
-		log.Printf("failed to delete users: %s", err)
+	// Delete dependents before users so the ON DELETE CASCADE doesn't hide
+	// their counts.
+	var deleted struct {
+		RefreshTokens int64 `json:"refresh_tokens"`
+		Chirps        int64 `json:"chirps"`
+		Users         int64 `json:"users"`
 	}
-	err = cfg.queries.DeleteAllChirps(r.Context())
-	if err != nil {
-		log.Printf("failed to delete chirps: %s", err)
-	}
-	err = cfg.queries.DeleteAllRefreshTokens(r.Context())
+	step := ""
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		step = "refresh_tokens"
+		if deleted.RefreshTokens, err = q.DeleteAllRefreshTokens(r.Context()); err != nil {
+			return err
+		}
+		step = "chirps"
+		if deleted.Chirps, err = q.DeleteAllChirps(r.Context()); err != nil {
+			return err
+		}
+		step = "users"
+		deleted.Users, err = q.DeleteAllUsers(r.Context())
+		return err
+	})
 	if err != nil {
-		log.Printf("failed to delete refresh tokens: %s", err)
+		log.Printf("reset failed deleting %s: %s", step, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("reset failed deleting %s, nothing was deleted", step))
+		return
 	}
 	cfg.fileserverHits.Store(0)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Hits reset to 0"))
+	respondWithJSON(w, http.StatusOK, struct {
+		HitsReset bool `json:"hits_reset"`
+		Deleted   any  `json:"deleted"`
+	}{true, deleted})
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body   string    `json:"body"`
-		UserID uuid.UUID `json:"user_id"`
+		Body          string     `json:"body"`
+		UserID        uuid.UUID  `json:"user_id"` // deprecated, ignored
+		IsSensitive   bool       `json:"is_sensitive"`
+		QuotedChirpID *uuid.UUID `json:"quoted_chirp_id"`
+		PublishAt     *time.Time `json:"publish_at"`
 	}
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Something went wrong: %v", err))
+		respondInternal(w, r, fmt.Errorf("something went wrong: %w", err))
 		return
 	}
-	if len(params.Body) > 140 {
-		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
-		return
+	if params.UserID != uuid.Nil {
+		deprecate(w, userIDBodySunset)
 	}
-
-	token, err := auth.GetBearerToken(r.Header)
+	body, truncated, err := cfg.fitChirpLength(params.Body)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Request is missing a JWT: %s", err))
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	userid, err := auth.ValidateJWT(token, cfg.secret)
+
+	userid, err := cfg.authenticateUser(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Invalid JWT: %s", err))
+		respondAuthError(w, r, err)
 		return
 	}
 
-	cleaned := make([]string, 0)
-	for _, word := range strings.Fields(params.Body) {
-		if strings.EqualFold(word, "kerfuffle") ||
-			strings.EqualFold(word, "sharbert") ||
-			strings.EqualFold(word, "fornax") {
-			word = "****"
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		stored, err := cfg.queries.GetIdempotencyKey(r.Context(), database.GetIdempotencyKeyParams{
+			UserID: userid,
+			Key:    idempotencyKey,
+		})
+		if err == nil {
+			cfg.respondIdempotentChirp(w, r, stored)
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			respondInternal(w, r, fmt.Errorf("couldn't look up idempotency key: %w", err))
+			return
 		}
-		cleaned = append(cleaned, word)
 	}
-	cleaned_string := strings.Join(cleaned, " ")
+
+	quotedChirpID := uuid.NullUUID{}
+	if params.QuotedChirpID != nil {
+		if !cfg.enabled(featureQuotes) {
+			respondFeatureDisabled(w, "Quoting chirps")
+			return
+		}
+		quoted, err := cfg.queries.GetChirpByID(r.Context(), *params.QuotedChirpID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !isPublished(quoted) && quoted.UserID != userid) {
+			respondWithError(w, http.StatusNotFound, "Quoted chirp not found")
+			return
+		} else if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't look up quoted chirp: %w", err))
+			return
+		}
+		quotedChirpID = uuid.NullUUID{UUID: *params.QuotedChirpID, Valid: true}
+	}
+
+	publishAt := sql.NullTime{}
+	if params.PublishAt != nil {
+		if !cfg.enabled(featureScheduling) {
+			respondFeatureDisabled(w, "Scheduling chirps")
+			return
+		}
+		if !params.PublishAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "publish_at must be in the future")
+			return
+		}
+		publishAt = sql.NullTime{Time: *params.PublishAt, Valid: true}
+	}
+
+	cleaned_string, ok := cfg.cleanChirpBody(w, body)
+	if !ok {
+		return
+	}
 	newChirpParams := database.CreateChirpParams{
-		Body:   cleaned_string,
-		UserID: userid,
+		Body:          cleaned_string,
+		UserID:        userid,
+		IsSensitive:   params.IsSensitive,
+		QuotedChirpID: quotedChirpID,
+		PublishAt:     publishAt,
 	}
 
-	newChirp, err := cfg.queries.CreateChirp(r.Context(), newChirpParams)
+	// The chirp and its idempotency key are committed together, and only
+	// then is the response written, so a client can read back the returned
+	// ID straight away. A concurrent request with the same key can get past
+	// the lookup above too; whichever stores the key second rolls back its
+	// chirp and answers with the first one instead.
+	var newChirp database.Chirp
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		newChirp, err = q.CreateChirp(r.Context(), newChirpParams)
+		if err != nil {
+			return fmt.Errorf("couldn't create chirp: %w", err)
+		}
+		if idempotencyKey == "" {
+			return nil
+		}
+		stored, err := q.CreateIdempotencyKey(r.Context(), database.CreateIdempotencyKeyParams{
+			Key:       idempotencyKey,
+			UserID:    userid,
+			ChirpID:   newChirp.ID,
+			ExpiresAt: time.Now().Add(cfg.idempotencyTTL),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't store idempotency key: %w", err)
+		}
+		if stored == 0 {
+			return errIdempotencyKeyTaken
+		}
+		return nil
+	})
+	if errors.Is(err, errIdempotencyKeyTaken) {
+		stored, err := cfg.queries.GetIdempotencyKey(r.Context(), database.GetIdempotencyKeyParams{
+			UserID: userid,
+			Key:    idempotencyKey,
+		})
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't look up idempotency key: %w", err))
+			return
+		}
+		cfg.respondIdempotentChirp(w, r, stored)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to create chirp: %v", err))
+		respondInternal(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, newChirp)
+	res, err := cfg.chirpResponse(r.Context(), newChirp)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't load quoted chirp: %w", err))
+		return
+	}
+	res.Truncated = truncated
+	respondWithJSON(w, http.StatusCreated, res)
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
-	author_id := r.URL.Query().Get("author_id")
-	var chirps []database.Chirp
-	var err error
-	if author_id == "" {
-		chirps, err = cfg.queries.GetAllChirps(r.Context())
+	fields, err := parseFields(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	desc, err := parseSort(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var author uuid.NullUUID
+	if authorID := r.URL.Query().Get("author_id"); authorID != "" {
+		uid, err := uuid.Parse(authorID)
 		if err != nil {
-			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Error retrieving all chirps: %v", err))
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error bad user id: %v", err))
 			return
 		}
-	} else {
-		uid, err := uuid.Parse(author_id)
+		author = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+	// With limit or cursor the client gets one page wrapped like the feed;
+	// without either the whole list is returned as a bare array.
+	if q := r.URL.Query(); q.Has("limit") || q.Has("cursor") {
+		cfg.serveChirpPage(w, r, fields, author, desc)
+		return
+	}
+	var chirps []database.Chirp
+	if !author.Valid {
+		chirps, err = cfg.readQueries.GetAllChirps(r.Context())
 		if err != nil {
-			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error bad user id: %v", err))
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Error retrieving all chirps: %v", err))
 			return
 		}
-		chirps, err = cfg.queries.GetChirpsByAuthor(r.Context(), uid)
+	} else {
+		chirps, err = cfg.readQueries.GetChirpsByAuthor(r.Context(), author.UUID)
 		if err != nil {
 			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Error retrieving chirps by author: %v", err))
 			return
 		}
 	}
-	srt := r.URL.Query().Get("sort")
-	if srt == "desc" {
+	if r.URL.Query().Get("exclude_sensitive") == "true" {
+		filtered := make([]database.Chirp, 0, len(chirps))
+		for _, chirp := range chirps {
+			if !chirp.IsSensitive {
+				filtered = append(filtered, chirp)
+			}
+		}
+		chirps = filtered
+	}
+	if desc {
 		sort.Slice(chirps, func(i, j int) bool {
 			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
 		})
 	}
 
-	respondWithJSON(w, http.StatusOK, chirps)
+	res, err := cfg.decorateChirps(r, chirps, fields)
+	if err != nil {
+		respondInternal(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
 }
 
 func (cfg *apiConfig) handlerGetChirpByID(w http.ResponseWriter, r *http.Request) {
+	fields, err := parseFields(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	chirpID := r.PathValue("chirpID")
 	if chirpID == "" {
 		respondWithError(w, http.StatusNotFound, "Malformed request")
@@ -213,13 +666,42 @@ func (cfg *apiConfig) handlerGetChirpByID(w http.ResponseWriter, r *http.Request
 		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Bad chirp UUID: %v", err))
 		return
 	}
-	chirp, err := cfg.queries.GetChirpByID(r.Context(), uid)
+	chirp, err := cfg.readQueries.GetChirpByID(r.Context(), uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A lagging replica may not have a chirp that was just created yet,
+		// and creating one promises it can be read back straight away.
+		chirp, err = cfg.queries.GetChirpByID(r.Context(), uid)
+	}
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Failed to retrieve chirp: %v", err))
 		return
 	}
-	respondWithJSON(w, http.StatusOK, chirp)
-
+	author, err := cfg.readQueries.GetUserByID(r.Context(), chirp.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		author, err = cfg.queries.GetUserByID(r.Context(), chirp.UserID)
+	}
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't get chirp author: %w", err))
+		return
+	}
+	if !author.IsActive {
+		respondWithError(w, http.StatusNotFound, "Failed to retrieve chirp: chirp not found")
+		return
+	}
+	if !isPublished(chirp) {
+		// Scheduled chirps are only visible to their author until published.
+		viewer := cfg.optionalAuth(r)
+		if !viewer.Valid || viewer.UUID != chirp.UserID {
+			respondWithError(w, http.StatusNotFound, "Failed to retrieve chirp: chirp not found")
+			return
+		}
+	}
+	res, err := cfg.decorateChirps(r, []database.Chirp{chirp}, fields)
+	if err != nil {
+		respondInternal(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res[0])
 }
 
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -229,85 +711,191 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	}{}
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't decode parameters: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't decode parameters: %w", err))
+		return
+	}
+	reqBody.Email = normalizeEmail(reqBody.Email)
+	if err := checkMaxLength("email", reqBody.Email, cfg.maxEmailLength); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !isValidEmail(reqBody.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if err := validatePassword(reqBody.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if cfg.isBanned(reqBody.Email) {
+		respondWithError(w, http.StatusForbidden, "This account cannot be used")
 		return
 	}
 	userParams := database.CreateUserParams{
 		Email:          reqBody.Email,
 		HashedPassword: reqBody.Password,
 	}
-	userParams.HashedPassword, err = auth.HashPassword(reqBody.Password)
+	userParams.HashedPassword, err = cfg.passwordHasher.Hash(reqBody.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't hash the password: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't hash the password: %w", err))
+		return
 	}
-	usr, err := cfg.queries.CreateUser(r.Context(), userParams)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't create user: %s", err))
+	var usr database.User
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		usr, err = q.CreateUser(r.Context(), userParams)
+		if err != nil {
+			return fmt.Errorf("couldn't create user: %w", err)
+		}
+		if cfg.welcomeChirp != "" {
+			_, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+				Body:   cfg.welcomeChirp,
+				UserID: usr.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't create welcome chirp: %w", err)
+			}
+		}
+		return nil
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "email already registered")
 		return
 	}
-	nuser := User{
-		ID:          usr.ID,
-		CreatedAt:   usr.CreatedAt,
-		UpdatedAt:   usr.UpdatedAt,
-		Email:       usr.Email,
-		IsChirpyRed: usr.IsChirpyRed,
+	if err != nil {
+		respondInternal(w, r, err)
+		return
 	}
-	respondWithJSON(w, http.StatusCreated, nuser)
+	respondWithJSON(w, http.StatusCreated, userToResponse(usr, userResponseOpts{V2: wantsV2(r)}))
 }
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
+	cfg.login(w, r, false)
+}
+
+// handlerReactivate logs in like handlerLogin, reactivating the account
+// first if it was deactivated.
+func (cfg *apiConfig) handlerReactivate(w http.ResponseWriter, r *http.Request) {
+	cfg.login(w, r, true)
+}
+
+// dummyPasswordHash is checked against when a login names an unknown email.
+// It comes from the configured hasher so it costs as much to check as a
+// real account's hash.
+func (cfg *apiConfig) dummyPasswordHash() string {
+	cfg.dummyHashOnce.Do(func() {
+		cfg.dummyHash, _ = cfg.passwordHasher.Hash("not the password of any account")
+	})
+	return cfg.dummyHash
+}
+
+func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request, reactivate bool) {
 	reqBody := struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}{}
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't decode parameters: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't decode parameters: %w", err))
 		return
 	}
+	// Unknown emails and wrong passwords get the same response so the
+	// status can't be used to find out which accounts exist.
 	usr, err := cfg.queries.GetUserByEmail(r.Context(), reqBody.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Spend as long as a real password check would, so response
+		// times don't give the account's existence away either.
+		auth.CheckPasswordHash(cfg.dummyPasswordHash(), reqBody.Password)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't find user")
+		respondInternal(w, r, fmt.Errorf("couldn't find user: %w", err))
 		return
 	}
 	err = auth.CheckPasswordHash(usr.HashedPassword, reqBody.Password)
 	if err != nil {
-		respondWithJSON(w, http.StatusUnauthorized, fmt.Sprintf("Incorrect email or password: %s", err))
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 		return
 	}
-	token, err := auth.MakeJWT(usr.ID, cfg.secret, time.Hour)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't make JWT: %s", err))
+	if cfg.isBanned(usr.Email) {
+		respondWithError(w, http.StatusForbidden, "This account cannot be used")
 		return
 	}
-	refresh_token, _ := auth.MakeRefreshToken()
-	dbtoken, err := cfg.queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refresh_token,
-		UserID:    usr.ID,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
-	})
+	if !usr.IsActive {
+		if !reactivate {
+			respondWithError(w, http.StatusForbidden, "Account is deactivated, log in via POST /api/reactivate to reactivate it")
+			return
+		}
+		err = cfg.queries.SetUserActive(r.Context(), database.SetUserActiveParams{
+			IsActive: true,
+			ID:       usr.ID,
+		})
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't reactivate user: %w", err))
+			return
+		}
+		cfg.audit(r, usr.ID, auditReactivate, usr.ID)
+	}
+	if cfg.passwordHasher.NeedsRehash(usr.HashedPassword) {
+		if hashed, err := cfg.passwordHasher.Hash(reqBody.Password); err != nil {
+			log.Printf("failed to rehash password for user %s: %s", usr.ID, err)
+		} else if err := cfg.queries.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword: hashed,
+			ID:             usr.ID,
+		}); err != nil {
+			log.Printf("failed to store rehashed password for user %s: %s", usr.ID, err)
+		}
+	}
+	token, err := cfg.makeAccessToken(usr)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't get refresh token: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't make JWT: %w", err))
 		return
 	}
-	nuser := struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
-	}{
-		ID:           usr.ID,
-		Email:        usr.Email,
-		CreatedAt:    usr.CreatedAt,
-		UpdatedAt:    usr.UpdatedAt,
+	// Service clients re-authenticate with their credentials and have no
+	// use for a refresh token, so don't create one for them.
+	refresh_token := ""
+	if r.Header.Get("X-Client-Type") != "service" {
+		if cfg.sessionLimiter != nil {
+			if ok, retryAfter := cfg.sessionLimiter.allow(cfg.clientIP(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				respondWithError(w, http.StatusTooManyRequests, "Too many sessions created, try again later")
+				return
+			}
+		}
+		refresh_token, _ = auth.MakeRefreshToken()
+		_, err = cfg.queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+			Token:     refresh_token,
+			UserID:    usr.ID,
+			ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
+		})
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't get refresh token: %w", err))
+			return
+		}
+	}
+	cfg.audit(r, usr.ID, auditLogin, usr.ID)
+	opts := userResponseOpts{
+		V2:           wantsV2(r),
 		Token:        token,
-		RefreshToken: dbtoken.Token,
-		IsChirpyRed:  usr.IsChirpyRed,
+		RefreshToken: refresh_token,
+	}
+	if r.URL.Query().Get("include") == "chirps" {
+		// Saves clients a round trip right after login.
+		chirps, err := cfg.queries.GetRecentChirpsByAuthor(r.Context(), database.GetRecentChirpsByAuthorParams{
+			UserID:   usr.ID,
+			RowLimit: loginRecentChirps,
+		})
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't get recent chirps: %w", err))
+			return
+		}
+		opts.Chirps, err = cfg.chirpResponses(r.Context(), chirps)
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't load quoted chirps: %w", err))
+			return
+		}
 	}
-	respondWithJSON(w, http.StatusOK, nuser)
+	respondWithJSON(w, http.StatusOK, userToResponse(usr, opts))
 }
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
@@ -330,7 +918,11 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("invalid user: %s", err))
 		return
 	}
-	token, err := auth.MakeJWT(usr.ID, cfg.secret, time.Hour)
+	if !usr.IsActive {
+		respondWithError(w, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+	token, err := cfg.makeAccessToken(usr)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("failed to create JWT: %s", err))
 		return
@@ -354,58 +946,108 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusNoContent, struct{}{})
 }
 
-func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+// handlerRevokeAll logs the authenticated user out everywhere by revoking
+// every refresh token they hold. Access tokens already issued stay valid
+// until they expire.
+func (cfg *apiConfig) handlerRevokeAll(w http.ResponseWriter, r *http.Request) {
+	userid, err := cfg.authenticateUser(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Access token not found: %s", err))
+		respondAuthError(w, r, err)
+		return
+	}
+	if _, err := cfg.queries.RevokeAllRefreshTokensForUser(r.Context(), userid); err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't revoke sessions: %w", err))
 		return
 	}
-	userid, err := auth.ValidateJWT(token, cfg.secret)
+	cfg.audit(r, userid, auditSessionsRevoke, userid)
+	respondWithJSON(w, http.StatusNoContent, struct{}{})
+}
+
+// handlerUsers updates the authenticated user's email and/or password. Only
+// the fields present in the body are changed, so either can be sent alone.
+func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
+	userid, err := cfg.authenticateUser(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Invalid token: %s", err))
+		respondAuthError(w, r, err)
 		return
 	}
 	reqBody := struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password *string `json:"password"`
+		Email    *string `json:"email"`
 	}{}
 	err = json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't decode parameters: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't decode parameters: %w", err))
 		return
 	}
-	hashed_password, err := auth.HashPassword(reqBody.Password)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't hash password: %s", err))
+	if reqBody.Email == nil && reqBody.Password == nil {
+		respondWithError(w, http.StatusBadRequest, "Nothing to update: send email and/or password")
+		return
+	}
+	params := database.UpdateUserParams{ID: userid}
+	if reqBody.Email != nil {
+		email := normalizeEmail(*reqBody.Email)
+		if err := checkMaxLength("email", email, cfg.maxEmailLength); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !isValidEmail(email) {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		params.Email = sql.NullString{String: email, Valid: true}
+	}
+	if reqBody.Password != nil {
+		if err := validatePassword(*reqBody.Password); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		hashed_password, err := cfg.passwordHasher.Hash(*reqBody.Password)
+		if err != nil {
+			respondInternal(w, r, fmt.Errorf("couldn't hash password: %w", err))
+			return
+		}
+		params.HashedPassword = sql.NullString{String: hashed_password, Valid: true}
+	}
+	usr, err := cfg.queries.UpdateUser(r.Context(), params)
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "email already registered")
 		return
 	}
-	usr, err := cfg.queries.UpdateUser(r.Context(), database.UpdateUserParams{
-		Email:          reqBody.Email,
-		HashedPassword: hashed_password,
-		ID:             userid,
-	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't update user: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't update user: %w", err))
 		return
 	}
-	respondWithJSON(w, http.StatusOK, User{
-		ID:          usr.ID,
-		CreatedAt:   usr.CreatedAt,
-		UpdatedAt:   usr.UpdatedAt,
-		Email:       usr.Email,
-		IsChirpyRed: usr.IsChirpyRed,
-	})
+	if params.HashedPassword.Valid {
+		cfg.audit(r, userid, auditPasswordChange, userid)
+	}
+	respondWithJSON(w, http.StatusOK, userToResponse(usr, userResponseOpts{V2: wantsV2(r)}))
 }
 
-func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+// handlerDeactivate hides the authenticated user's chirps and blocks their
+// logins until they reactivate, without deleting any data.
+func (cfg *apiConfig) handlerDeactivate(w http.ResponseWriter, r *http.Request) {
+	userid, err := cfg.authenticateUser(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Access token not found: %s", err))
+		respondAuthError(w, r, err)
 		return
 	}
-	userid, err := auth.ValidateJWT(token, cfg.secret)
+	err = cfg.queries.SetUserActive(r.Context(), database.SetUserActiveParams{
+		IsActive: false,
+		ID:       userid,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Invalid token: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't deactivate user: %w", err))
+		return
+	}
+	cfg.audit(r, userid, auditDeactivate, userid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	userid, err := cfg.authenticateUser(r)
+	if err != nil {
+		respondAuthError(w, r, err)
 		return
 	}
 	chirpID := r.PathValue("chirpID")
@@ -425,31 +1067,113 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 	}
 	err = cfg.queries.DeleteChirp(r.Context(), chirp_id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't delete chirp: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't delete chirp: %w", err))
 		return
 	}
 	respondWithJSON(w, http.StatusNoContent, struct{}{})
 }
 
-func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request) {
-	apiKey, err := auth.GetAPIKey(r.Header)
+// handlerUpdateChirp replaces the body of one of the authenticated user's
+// chirps, applying the same length limit and profanity policy as creation.
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	userid, err := cfg.authenticateUser(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Couldn't find polka key: %s", err))
+		respondAuthError(w, r, err)
 		return
 	}
-	if apiKey != cfg.polka_key {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Wrong polka key: %s", err))
+	chirp_id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Bad chirp UUID: %v", err))
 		return
 	}
-	reqBody := struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
+	params := struct {
+		Body string `json:"body"`
 	}{}
-	err = json.NewDecoder(r.Body).Decode(&reqBody)
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Couldn't decode parameters: %v", err))
+		return
+	}
+	chirp, err := cfg.queries.GetChirpByID(r.Context(), chirp_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	} else if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't get chirp: %w", err))
+		return
+	}
+	if chirp.UserID != userid {
+		respondWithError(w, http.StatusForbidden, "Forbidden: Wrong user")
+		return
+	}
+	body, truncated, err := cfg.fitChirpLength(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body, ok := cfg.cleanChirpBody(w, body)
+	if !ok {
+		return
+	}
+	chirp, err = cfg.queries.UpdateChirp(r.Context(), database.UpdateChirpParams{
+		Body: body,
+		ID:   chirp_id,
+	})
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't update chirp: %w", err))
+		return
+	}
+	res, err := cfg.chirpResponse(r.Context(), chirp)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't decode parameters: %s", err))
+		respondInternal(w, r, fmt.Errorf("couldn't load quoted chirp: %w", err))
+		return
+	}
+	res.Truncated = truncated
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request) {
+	if cfg.polka_key == "" {
+		respondWithError(w, http.StatusServiceUnavailable, "Polka webhooks are not configured")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "webhook payload too large")
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Couldn't read webhook payload: %s", err))
+		return
+	}
+	if r.Header.Get("X-Polka-Signature") != "" || !cfg.polkaAllowAPIKey {
+		if err := verifyWebhookSignature(r.Header, body, cfg.polka_key); err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+	} else {
+		apiKey, err := auth.GetAPIKey(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Couldn't find polka key: %s", err))
+			return
+		}
+		if apiKey != cfg.polka_key {
+			respondWithError(w, http.StatusUnauthorized, "Wrong polka key")
+			return
+		}
+	}
+	if cfg.webhookNonces != nil {
+		if err := cfg.webhookNonces.checkReplay(r.Header); errors.Is(err, errReplayedWebhook) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		} else if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+	}
+	reqBody, err := decodeWebhook(bytes.NewReader(body))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid webhook payload: %s", err))
 		return
 	}
 	if reqBody.Event != "user.upgraded" {
@@ -458,13 +1182,19 @@ func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request)
 	}
 	uid, err := uuid.Parse(reqBody.Data.UserID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Couldn't decode user id: %s", err))
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid webhook user id: %s", err))
 		return
 	}
 	_, err = cfg.queries.UpgradeUser(r.Context(), uid)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Couldn't find user: %s", err))
 		return
 	}
+	if err != nil {
+		cfg.webhookNonces.release(r.Header)
+		respondInternal(w, r, fmt.Errorf("couldn't upgrade user: %w", err))
+		return
+	}
+	cfg.audit(r, uuid.Nil, auditChirpyRedUpgrade, uid)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,832 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCreateChirpIsReadableAfterResponse(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+	token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hello world"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Idempotency-Key", "abc")
+	rec := httptest.NewRecorder()
+	cfg.handlerCreateChirp(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if store.commits != 1 {
+		t.Errorf("commits = %d, want 1 before responding", store.commits)
+	}
+
+	var created Chirp
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("couldn't decode response: %v", err)
+	}
+	got, err := cfg.queries.GetChirpByID(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("GetChirpByID() right after create error = %v", err)
+	}
+	if got.Body != "hello world" || got.UserID != userID {
+		t.Errorf("GetChirpByID() = %q by %v, want %q by %v", got.Body, got.UserID, "hello world", userID)
+	}
+}
+
+func TestHandlerDBHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		closeDB    bool
+		wantStatus int
+	}{
+		{
+			name:       "Database reachable",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Database closed",
+			closeDB:    true,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTxTestConfig(t, &txRecorder{})
+			if tt.closeDB {
+				cfg.db.Close()
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerDBHealth(rec, httptest.NewRequest(http.MethodGet, "/api/healthz/db", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+		})
+	}
+}
+
+func TestHandlerResetIsAtomic(t *testing.T) {
+	tests := []struct {
+		name          string
+		failQuery     string
+		wantStatus    int
+		wantBody      string
+		wantCommits   int
+		wantRollbacks int
+	}{
+		{
+			name:          "All deletes succeed",
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"hits_reset":true,"deleted":{"refresh_tokens":1,"chirps":1,"users":1}}`,
+			wantCommits:   1,
+			wantRollbacks: 0,
+		},
+		{
+			name:          "Chirp delete fails",
+			failQuery:     deleteAllChirpsQuery,
+			wantStatus:    http.StatusInternalServerError,
+			wantBody:      `{"error":"reset failed deleting chirps, nothing was deleted"}`,
+			wantCommits:   0,
+			wantRollbacks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &txRecorder{failQuery: tt.failQuery}
+			cfg := newTxTestConfig(t, d)
+			cfg.platform = "dev"
+
+			rec := httptest.NewRecorder()
+			cfg.handlerReset(rec, httptest.NewRequest(http.MethodPost, "/admin/reset", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+			if d.commits != tt.wantCommits || d.rollbacks != tt.wantRollbacks {
+				t.Errorf("commits = %d, rollbacks = %d, want %d and %d", d.commits, d.rollbacks, tt.wantCommits, tt.wantRollbacks)
+			}
+		})
+	}
+}
+
+func TestRefreshUsesJWTExpiry(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	cfg.jwtExpiry = 15 * time.Minute
+	refreshToken := store.seedRefreshToken(store.seedUser("user@example.com"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshToken)
+	rec := httptest.NewRecorder()
+	cfg.handlerRefresh(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("couldn't decode response: %v", err)
+	}
+	claims, err := auth.ParseClaims(res.Token, cfg.secret, 0)
+	if err != nil {
+		t.Fatalf("ParseClaims() error = %v", err)
+	}
+	if left := time.Until(claims.ExpiresAt.Time); left > cfg.jwtExpiry || left < cfg.jwtExpiry-time.Minute {
+		t.Errorf("token expires in %s, want about %s", left, cfg.jwtExpiry)
+	}
+}
+
+func TestRevokeAllLogsOutEverywhere(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	cfg.jwtExpiry = time.Hour
+	userID := store.seedUser("user@example.com")
+	sessions := []string{store.seedRefreshToken(userID), store.seedRefreshToken(userID)}
+	otherSession := store.seedRefreshToken(store.seedUser("other@example.com"))
+
+	token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+	req := httptest.NewRequest(http.MethodPost, "/api/revoke-all", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	cfg.handlerRevokeAll(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	refresh := func(refreshToken string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+refreshToken)
+		rec := httptest.NewRecorder()
+		cfg.handlerRefresh(rec, req)
+		return rec.Code
+	}
+	for _, session := range sessions {
+		if code := refresh(session); code != http.StatusUnauthorized {
+			t.Errorf("refresh with revoked token status = %d, want %d", code, http.StatusUnauthorized)
+		}
+	}
+	if code := refresh(otherSession); code != http.StatusOK {
+		t.Errorf("refresh with another user's token status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	cfg.passwordHasher, _ = auth.NewPasswordHasher("")
+	store.seedUser("user@example.com")
+
+	tests := []struct {
+		name  string
+		email string
+	}{
+		{
+			name:  "Wrong password",
+			email: "user@example.com",
+		},
+		{
+			name:  "Unknown email",
+			email: "nobody@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"email":"` + tt.email + `","password":"wrong password 1"}`
+			rec := httptest.NewRecorder()
+			cfg.handlerLogin(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if got, want := strings.TrimSpace(rec.Body.String()), `{"error":"Incorrect email or password"}`; got != want {
+				t.Errorf("body = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	weakBcrypt, _ := bcrypt.GenerateFromPassword([]byte("hunter42!"), bcrypt.MinCost)
+	current, _ := auth.NewPasswordHasher("argon2id")
+	currentHash, _ := current.Hash("hunter42!")
+
+	tests := []struct {
+		name        string
+		algo        string
+		stored      string
+		wantReplace bool
+	}{
+		{
+			name:        "Old bcrypt cost",
+			algo:        "bcrypt",
+			stored:      string(weakBcrypt),
+			wantReplace: true,
+		},
+		{
+			name:        "Old algorithm",
+			algo:        "argon2id",
+			stored:      string(weakBcrypt),
+			wantReplace: true,
+		},
+		{
+			name:        "Current parameters",
+			algo:        "argon2id",
+			stored:      currentHash,
+			wantReplace: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.passwordHasher, _ = auth.NewPasswordHasher(tt.algo)
+			userID := store.seedUser("user@example.com")
+			store.users[userID.String()][4] = tt.stored
+
+			body := `{"email":"user@example.com","password":"hunter42!"}`
+			rec := httptest.NewRecorder()
+			cfg.handlerLogin(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			got := store.users[userID.String()][4].(string)
+			if replaced := got != tt.stored; replaced != tt.wantReplace {
+				t.Fatalf("stored hash replaced = %v, want %v", replaced, tt.wantReplace)
+			}
+			if cfg.passwordHasher.NeedsRehash(got) {
+				t.Errorf("stored hash %q still needs a rehash", got)
+			}
+			if err := auth.CheckPasswordHash(got, "hunter42!"); err != nil {
+				t.Errorf("CheckPasswordHash() on the stored hash error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDummyPasswordHashUsesConfiguredHasher(t *testing.T) {
+	tests := []struct {
+		name string
+		algo string
+	}{
+		{
+			name: "bcrypt",
+			algo: "bcrypt",
+		},
+		{
+			name: "argon2id",
+			algo: "argon2id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{}
+			cfg.passwordHasher, _ = auth.NewPasswordHasher(tt.algo)
+			hash := cfg.dummyPasswordHash()
+			if hash == "" || cfg.passwordHasher.NeedsRehash(hash) {
+				t.Errorf("dummyPasswordHash() = %q, not produced by the %s hasher", hash, tt.algo)
+			}
+		})
+	}
+}
+
+func TestLoginDatabaseFailure(t *testing.T) {
+	cfg := newTxTestConfig(t, &txRecorder{})
+	body := `{"email":"user@example.com","password":"hunter42!"}`
+	rec := httptest.NewRecorder()
+	cfg.handlerLogin(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(rec.Body.String(), "Incorrect email or password") {
+		t.Errorf("body = %s, want a server error rather than a credentials error", rec.Body)
+	}
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	cfg, _ := newChirpStoreConfig(t)
+	cfg.maxEmailLength = 254
+	cfg.passwordHasher, _ = auth.NewPasswordHasher("")
+
+	wantStatus := []int{http.StatusCreated, http.StatusConflict}
+	for i, email := range []string{"user@example.com", "User@Example.com"} {
+		body := `{"email":"` + email + `","password":"hunter42!"}`
+		rec := httptest.NewRecorder()
+		cfg.handlerCreateUser(rec, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(body)))
+		if rec.Code != wantStatus[i] {
+			t.Fatalf("attempt %d status = %d, want %d: %s", i+1, rec.Code, wantStatus[i], rec.Body)
+		}
+		if i == 1 && strings.Contains(rec.Body.String(), "duplicate key") {
+			t.Errorf("body = %s, leaks the database error", rec.Body)
+		}
+	}
+}
+
+func TestUpdateUserPartial(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantEmail    string
+		wantPassword string
+	}{
+		{
+			name:         "Email only",
+			body:         `{"email":"new@example.com"}`,
+			wantStatus:   http.StatusOK,
+			wantEmail:    "new@example.com",
+			wantPassword: "original123",
+		},
+		{
+			name:         "Password only",
+			body:         `{"password":"changed123"}`,
+			wantStatus:   http.StatusOK,
+			wantEmail:    "user@example.com",
+			wantPassword: "changed123",
+		},
+		{
+			name:         "Both",
+			body:         `{"email":"new@example.com","password":"changed123"}`,
+			wantStatus:   http.StatusOK,
+			wantEmail:    "new@example.com",
+			wantPassword: "changed123",
+		},
+		{
+			name:         "Neither",
+			body:         `{}`,
+			wantStatus:   http.StatusBadRequest,
+			wantEmail:    "user@example.com",
+			wantPassword: "original123",
+		},
+		{
+			name:         "Empty password is validated, not skipped",
+			body:         `{"password":""}`,
+			wantStatus:   http.StatusBadRequest,
+			wantEmail:    "user@example.com",
+			wantPassword: "original123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.maxEmailLength = 254
+			cfg.passwordHasher, _ = auth.NewPasswordHasher("")
+			userID := store.seedUser("user@example.com")
+			store.users[userID.String()][4], _ = cfg.passwordHasher.Hash("original123")
+			token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			cfg.handlerUsers(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			row := store.users[userID.String()]
+			if row[3] != tt.wantEmail {
+				t.Errorf("email = %v, want %q", row[3], tt.wantEmail)
+			}
+			if err := auth.CheckPasswordHash(row[4].(string), tt.wantPassword); err != nil {
+				t.Errorf("CheckPasswordHash(%q) error = %v", tt.wantPassword, err)
+			}
+		})
+	}
+}
+
+func TestUpdateChirp(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	owner, other := store.seedUser("owner@example.com"), store.seedUser("other@example.com")
+	chirpID := store.seed(owner, "helo world", time.Now())
+
+	tests := []struct {
+		name       string
+		user       uuid.UUID
+		chirpID    string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Owner edits",
+			user:       owner,
+			chirpID:    chirpID.String(),
+			body:       "hello kerfuffle world",
+			wantStatus: http.StatusOK,
+			wantBody:   "hello **** world",
+		},
+		{
+			name:       "Too long",
+			user:       owner,
+			chirpID:    chirpID.String(),
+			body:       strings.Repeat("a", maxChirpLength+1),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Someone else's chirp",
+			user:       other,
+			chirpID:    chirpID.String(),
+			body:       "mine now",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "Unknown chirp",
+			user:       owner,
+			chirpID:    uuid.NewString(),
+			body:       "hello",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _ := auth.MakeJWT(tt.user, cfg.secret, time.Hour)
+			body, _ := json.Marshal(map[string]string{"body": tt.body})
+			req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+tt.chirpID, bytes.NewReader(body))
+			req.SetPathValue("chirpID", tt.chirpID)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			cfg.handlerUpdateChirp(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			var got Chirp
+			json.NewDecoder(rec.Body).Decode(&got)
+			if got.Body != tt.wantBody {
+				t.Errorf("body = %q, want %q", got.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreateChirpIdempotencyRace(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+	token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+	// The competing request commits its chirp and key after this one has
+	// already missed the lookup, right before it stores the key itself.
+	var winner uuid.UUID
+	store.beforeExec = func(query string) {
+		if query != "CreateIdempotencyKey" || winner != uuid.Nil {
+			return
+		}
+		winner = store.seed(userID, "hello world", time.Now())
+		store.keys[userID.String()+"/abc"] = []driver.Value{"abc", userID.String(), winner.String(), time.Now(), time.Now().Add(time.Hour)}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hello world"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Idempotency-Key", "abc")
+	rec := httptest.NewRecorder()
+	cfg.handlerCreateChirp(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var got Chirp
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("couldn't decode response: %v", err)
+	}
+	if got.ID != winner {
+		t.Errorf("response chirp = %v, want the competing request's %v", got.ID, winner)
+	}
+	if len(store.committed) != 1 {
+		t.Errorf("committed chirps = %d, want 1", len(store.committed))
+	}
+}
+
+func TestCreateChirpIdempotency(t *testing.T) {
+	tests := []struct {
+		name          string
+		firstKey      string
+		secondKey     string
+		expireFirst   bool
+		wantSame      bool
+		wantCommitted int
+	}{
+		{
+			name:          "Same key",
+			firstKey:      "abc",
+			secondKey:     "abc",
+			wantSame:      true,
+			wantCommitted: 1,
+		},
+		{
+			name:          "Different keys",
+			firstKey:      "abc",
+			secondKey:     "def",
+			wantCommitted: 2,
+		},
+		{
+			name:          "Expired key",
+			firstKey:      "abc",
+			secondKey:     "abc",
+			expireFirst:   true,
+			wantCommitted: 2,
+		},
+		{
+			name:          "No key",
+			wantCommitted: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			userID := store.seedUser("user@example.com")
+			token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+			create := func(key string) Chirp {
+				t.Helper()
+				req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hello world"}`))
+				req.Header.Set("Authorization", "Bearer "+token)
+				if key != "" {
+					req.Header.Set("Idempotency-Key", key)
+				}
+				rec := httptest.NewRecorder()
+				cfg.handlerCreateChirp(rec, req)
+				if rec.Code != http.StatusCreated {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+				}
+				var chirp Chirp
+				if err := json.NewDecoder(rec.Body).Decode(&chirp); err != nil {
+					t.Fatalf("couldn't decode response: %v", err)
+				}
+				return chirp
+			}
+
+			first := create(tt.firstKey)
+			if tt.expireFirst {
+				store.keys[userID.String()+"/"+tt.firstKey][4] = time.Now().Add(-time.Minute)
+			}
+			second := create(tt.secondKey)
+
+			if same := first.ID == second.ID; same != tt.wantSame {
+				t.Errorf("second chirp = %v, first = %v, want same %v", second.ID, first.ID, tt.wantSame)
+			}
+			if len(store.committed) != tt.wantCommitted {
+				t.Errorf("committed chirps = %d, want %d", len(store.committed), tt.wantCommitted)
+			}
+		})
+	}
+}
+
+func TestCreateChirpQuote(t *testing.T) {
+	tests := []struct {
+		name       string
+		quoted     func(store *chirpStore, other uuid.UUID) uuid.UUID
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "Published chirp",
+			quoted: func(store *chirpStore, other uuid.UUID) uuid.UUID {
+				return store.seed(other, "original thought", time.Now())
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   "original thought",
+		},
+		{
+			name: "Unknown chirp",
+			quoted: func(store *chirpStore, other uuid.UUID) uuid.UUID {
+				return uuid.New()
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Someone else's scheduled chirp",
+			quoted: func(store *chirpStore, other uuid.UUID) uuid.UUID {
+				id := store.seed(other, "not yet", time.Now())
+				store.committed[id.String()][7] = time.Now().Add(time.Hour)
+				return id
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			userID := store.seedUser("user@example.com")
+			other := store.seedUser("other@example.com")
+			token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+			quoted := tt.quoted(store, other)
+
+			body := fmt.Sprintf(`{"body":"so true","quoted_chirp_id":%q}`, quoted)
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			cfg.handlerCreateChirp(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			var got Chirp
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("couldn't decode response: %v", err)
+			}
+			if got.QuotedChirp == nil || got.QuotedChirp.ID != quoted || got.QuotedChirp.Body != tt.wantBody {
+				t.Errorf("QuotedChirp = %+v, want %v with body %q", got.QuotedChirp, quoted, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGetChirpWithDeletedQuote(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+	quoted := store.seed(userID, "soon gone", time.Now())
+	quoting := store.seed(userID, "so true", time.Now())
+	store.committed[quoting.String()][6] = quoted.String()
+	delete(store.committed, quoted.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+quoting.String(), nil)
+	req.SetPathValue("chirpID", quoting.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerGetChirpByID(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got Chirp
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("couldn't decode response: %v", err)
+	}
+	if got.QuotedChirp == nil || got.QuotedChirp.Body != deletedChirpPlaceholder || !got.QuotedChirp.Deleted {
+		t.Errorf("QuotedChirp = %+v, want the deleted placeholder", got.QuotedChirp)
+	}
+}
+
+func TestBannedEmails(t *testing.T) {
+	hasher, _ := auth.NewPasswordHasher("")
+	hash, _ := hasher.Hash("hunter42!")
+
+	tests := []struct {
+		name       string
+		email      string
+		wantStatus map[string]int
+	}{
+		{
+			name:       "Allowed email",
+			email:      "user@example.com",
+			wantStatus: map[string]int{"register": http.StatusCreated, "login": http.StatusOK},
+		},
+		{
+			name:       "Banned email",
+			email:      "Spammer@Example.com",
+			wantStatus: map[string]int{"register": http.StatusForbidden, "login": http.StatusForbidden},
+		},
+		{
+			name:       "Banned domain",
+			email:      "someone@spam.test",
+			wantStatus: map[string]int{"register": http.StatusForbidden, "login": http.StatusForbidden},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.maxEmailLength = 254
+			cfg.passwordHasher = hasher
+			cfg.bannedEmails = map[string]struct{}{"spammer@example.com": {}}
+			cfg.bannedDomains = map[string]struct{}{"spam.test": {}}
+			body := `{"email":"` + tt.email + `","password":"hunter42!"}`
+
+			rec := httptest.NewRecorder()
+			cfg.handlerCreateUser(rec, httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(body)))
+			if rec.Code != tt.wantStatus["register"] {
+				t.Errorf("register status = %d, want %d: %s", rec.Code, tt.wantStatus["register"], rec.Body)
+			}
+
+			// Accounts registered before the ban can't log in either.
+			store.users = map[string][]driver.Value{}
+			userID := store.seedUser(tt.email)
+			store.users[userID.String()][4] = hash
+			rec = httptest.NewRecorder()
+			cfg.handlerLogin(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+			if rec.Code != tt.wantStatus["login"] {
+				t.Errorf("login status = %d, want %d: %s", rec.Code, tt.wantStatus["login"], rec.Body)
+			}
+			if rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), "ban") {
+				t.Errorf("body = %s, mentions the ban list", rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetChirpByIDBehindReplica(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	replica, _ := newChirpStoreConfig(t)
+	cfg.readQueries = replica.queries
+	userID := store.seedUser("user@example.com")
+	token, _ := auth.MakeJWT(userID, cfg.secret, time.Hour)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body":"hello world"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	cfg.handlerCreateChirp(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var created Chirp
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("couldn't decode response: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/chirps/"+created.ID.String(), nil)
+	req.SetPathValue("chirpID", created.ID.String())
+	rec = httptest.NewRecorder()
+	cfg.handlerGetChirpByID(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("read back status = %d, want %d while the replica lags: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestAccessTokenChirpyRedClaim(t *testing.T) {
+	hasher, _ := auth.NewPasswordHasher("")
+	hash, _ := hasher.Hash("hunter42!")
+
+	tests := []struct {
+		name     string
+		endpoint string
+		red      bool
+	}{
+		{
+			name:     "Login, Chirpy Red",
+			endpoint: "login",
+			red:      true,
+		},
+		{
+			name:     "Login, free tier",
+			endpoint: "login",
+		},
+		{
+			name:     "Refresh, Chirpy Red",
+			endpoint: "refresh",
+			red:      true,
+		},
+		{
+			name:     "Refresh, free tier",
+			endpoint: "refresh",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.passwordHasher = hasher
+			cfg.jwtExpiry = time.Hour
+			userID := store.seedUser("user@example.com")
+			store.users[userID.String()][4] = hash
+			store.users[userID.String()][5] = tt.red
+
+			rec := httptest.NewRecorder()
+			if tt.endpoint == "login" {
+				body := `{"email":"user@example.com","password":"hunter42!"}`
+				cfg.handlerLogin(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+			} else {
+				req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+				req.Header.Set("Authorization", "Bearer "+store.seedRefreshToken(userID))
+				cfg.handlerRefresh(rec, req)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var res struct {
+				Token string `json:"token"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatalf("couldn't decode response: %v", err)
+			}
+			claims, err := auth.ParseClaims(res.Token, cfg.secret, 0)
+			if err != nil {
+				t.Fatalf("ParseClaims() error = %v", err)
+			}
+			if claims.IsChirpyRed != tt.red {
+				t.Errorf("chirpy_red claim = %v, want %v", claims.IsChirpyRed, tt.red)
+			}
+		})
+	}
+}
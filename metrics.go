@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// routeHits counts requests per mux pattern, e.g. "GET /api/chirps".
+type routeHits struct {
+	mu     sync.RWMutex
+	counts map[string]*atomic.Int64
+}
+
+func (h *routeHits) inc(pattern string) {
+	h.mu.RLock()
+	n, ok := h.counts[pattern]
+	h.mu.RUnlock()
+	if !ok {
+		h.mu.Lock()
+		if h.counts == nil {
+			h.counts = make(map[string]*atomic.Int64)
+		}
+		if n, ok = h.counts[pattern]; !ok {
+			n = new(atomic.Int64)
+			h.counts[pattern] = n
+		}
+		h.mu.Unlock()
+	}
+	n.Add(1)
+}
+
+// snapshot returns the current counts and their total.
+func (h *routeHits) snapshot() (map[string]int64, int64) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := make(map[string]int64, len(h.counts))
+	var total int64
+	for pattern, n := range h.counts {
+		counts[pattern] = n.Load()
+		total += counts[pattern]
+	}
+	return counts, total
+}
+
+// middlewareRouteHits counts each request under the mux pattern that served
+// it. It must sit directly around the mux, which records the pattern on the
+// request as it routes it. Unmatched requests and the /app/ file server,
+// which has its own counter, aren't counted.
+func (cfg *apiConfig) middlewareRouteHits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if r.Pattern != "" && r.Pattern != "/app/" {
+			cfg.routeHits.inc(r.Pattern)
+		}
+	})
+}
+
+// handlerRouteMetrics returns the per-route request counts as JSON.
+func (cfg *apiConfig) handlerRouteMetrics(w http.ResponseWriter, r *http.Request) {
+	counts, total := cfg.routeHits.snapshot()
+	respondWithJSON(w, http.StatusOK, struct {
+		Routes map[string]int64 `json:"routes"`
+		Total  int64            `json:"total"`
+	}{counts, total})
+}
+
+// handlerMetricsJSON is the machine-readable counterpart of the HTML page
+// at GET /admin/metrics.
+func (cfg *apiConfig) handlerMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, struct {
+		FileserverHits int32 `json:"fileserver_hits"`
+	}{cfg.fileserverHits.Load()})
+}
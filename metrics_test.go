@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRouteMetrics(t *testing.T) {
+	cfg := &apiConfig{}
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux.HandleFunc("GET /api/chirps", ok)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", ok)
+	mux.HandleFunc("/app/", ok)
+	handler := cfg.middlewareRouteHits(mux)
+
+	var wg sync.WaitGroup
+	for _, target := range []string{"/api/chirps", "/api/chirps", "/api/chirps/1", "/api/chirps/2", "/app/index.html", "/missing"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+		}()
+	}
+	wg.Wait()
+
+	rec := httptest.NewRecorder()
+	cfg.handlerRouteMetrics(rec, httptest.NewRequest(http.MethodGet, "/admin/metrics/api", nil))
+	var got struct {
+		Routes map[string]int64 `json:"routes"`
+		Total  int64            `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("couldn't decode metrics: %v", err)
+	}
+	want := map[string]int64{"GET /api/chirps": 2, "GET /api/chirps/{chirpID}": 2}
+	if !reflect.DeepEqual(got.Routes, want) || got.Total != 4 {
+		t.Errorf("metrics = %v total %d, want %v total 4", got.Routes, got.Total, want)
+	}
+}
+
+func TestMetricsJSON(t *testing.T) {
+	cfg := &apiConfig{}
+	app := cfg.middlewareMetricsInc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 3 {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/app/", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerMetricsJSON(rec, httptest.NewRequest(http.MethodGet, "/admin/metrics.json", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if got, want := strings.TrimSpace(rec.Body.String()), `{"fileserver_hits":3}`; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/auth"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+// passwordResetTTL is how long a password reset token stays usable.
+const passwordResetTTL = time.Hour
+
+var errResetTokenInvalid = errors.New("invalid, expired or already used reset token")
+
+// handlerRequestPasswordReset emails a single-use reset token to an
+// account. Every request gets the same 202 whether or not the email belongs
+// to an account, and the token is issued and sent in the background so the
+// response time doesn't tell either.
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	reqBody := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Couldn't decode parameters: %v", err))
+		return
+	}
+	usr, err := cfg.queries.GetUserByEmail(r.Context(), normalizeEmail(reqBody.Email))
+	if err == nil {
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			if err := cfg.sendPasswordReset(ctx, usr); err != nil {
+				log.Printf("password reset for user %s failed (request %s): %s", usr.ID, requestID(r), err)
+			}
+		}()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("password reset lookup failed (request %s): %s", requestID(r), err)
+	}
+	respondWithJSON(w, http.StatusAccepted, struct {
+		Status string `json:"status"`
+	}{"If the email belongs to an account, a reset link is on its way"})
+}
+
+// sendPasswordReset replaces any outstanding reset tokens of usr with a new
+// one and mails it.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, usr database.User) error {
+	if cfg.mailer == nil {
+		return errors.New("no mailer configured")
+	}
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return fmt.Errorf("couldn't make reset token: %w", err)
+	}
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		if err := q.InvalidatePasswordResetTokens(ctx, usr.ID); err != nil {
+			return fmt.Errorf("couldn't invalidate old reset tokens: %w", err)
+		}
+		_, err := q.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			Token:     token,
+			UserID:    usr.ID,
+			ExpiresAt: time.Now().Add(passwordResetTTL),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't store reset token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.mailer.SendPasswordReset(ctx, usr.Email, token)
+}
+
+// handlerConfirmPasswordReset sets a new password using a reset token. The
+// token is consumed and every session of the account is revoked in the same
+// transaction as the password change.
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	reqBody := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Couldn't decode parameters: %v", err))
+		return
+	}
+	if err := validatePassword(reqBody.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hashed, err := cfg.passwordHasher.Hash(reqBody.Password)
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't hash password: %w", err))
+		return
+	}
+	var reset database.PasswordResetToken
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		reset, err = q.ConsumePasswordResetToken(r.Context(), reqBody.Token)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errResetTokenInvalid
+		} else if err != nil {
+			return fmt.Errorf("couldn't consume reset token: %w", err)
+		}
+		err = q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword: hashed,
+			ID:             reset.UserID,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't update password: %w", err)
+		}
+		if err := q.InvalidatePasswordResetTokens(r.Context(), reset.UserID); err != nil {
+			return fmt.Errorf("couldn't invalidate other reset tokens: %w", err)
+		}
+		if _, err := q.RevokeAllRefreshTokensForUser(r.Context(), reset.UserID); err != nil {
+			return fmt.Errorf("couldn't revoke sessions: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondInternal(w, r, err)
+		return
+	}
+	cfg.audit(r, reset.UserID, auditPasswordReset, reset.UserID)
+	respondWithJSON(w, http.StatusNoContent, struct{}{})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/auth"
+)
+
+// chanMailer hands every reset token it is asked to send to tokens.
+type chanMailer struct {
+	tokens chan string
+}
+
+func (m chanMailer) SendPasswordReset(ctx context.Context, to, token string) error {
+	m.tokens <- token
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	cfg.passwordHasher, _ = auth.NewPasswordHasher("")
+	mail := chanMailer{tokens: make(chan string, 4)}
+	cfg.mailer = mail
+	userID := store.seedUser("user@example.com")
+	refreshToken := store.seedRefreshToken(userID)
+
+	requestReset := func(email string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerRequestPasswordReset(rec, httptest.NewRequest(http.MethodPost, "/api/password-reset/request", strings.NewReader(`{"email":"`+email+`"}`)))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("request for %s: status = %d, want %d", email, rec.Code, http.StatusAccepted)
+		}
+		return rec.Body.String()
+	}
+	receive := func() string {
+		t.Helper()
+		select {
+		case token := <-mail.tokens:
+			return token
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reset token was mailed")
+			return ""
+		}
+	}
+
+	unknown := requestReset("nobody@example.com")
+	known := requestReset("User@Example.com")
+	if unknown != known {
+		t.Errorf("unknown email body = %s, known email body = %s, want them equal", unknown, known)
+	}
+	if strings.Contains(known, "token") {
+		t.Errorf("response body = %s, leaks the reset token", known)
+	}
+	first := receive()
+	select {
+	case token := <-mail.tokens:
+		t.Fatalf("mailed a second token %q, want only one for the known email", token)
+	default:
+	}
+	requestReset("user@example.com")
+	second := receive()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "Unknown token",
+			body:       `{"token":"nope","password":"newpass123"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Token replaced by a newer request",
+			body:       `{"token":"` + first + `","password":"newpass123"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Weak password",
+			body:       `{"token":"` + second + `","password":"short"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Valid token",
+			body:       `{"token":"` + second + `","password":"newpass123"}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Token already used",
+			body:       `{"token":"` + second + `","password":"another123"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			cfg.handlerConfirmPasswordReset(rec, httptest.NewRequest(http.MethodPost, "/api/password-reset/confirm", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	hashed := store.users[userID.String()][4].(string)
+	if err := auth.CheckPasswordHash(hashed, "newpass123"); err != nil {
+		t.Errorf("CheckPasswordHash() after reset error = %v", err)
+	}
+	if store.tokens[refreshToken][5] == nil {
+		t.Errorf("refresh token still active after password reset")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultProfaneWords are masked when PROFANITY_WORDS is unset.
+var defaultProfaneWords = map[string]struct{}{
+	"kerfuffle": {},
+	"sharbert":  {},
+	"fornax":    {},
+}
+
+// profaneWordsFromEnv returns the PROFANITY_WORDS list, or the defaults when
+// it is unset. With normalize set the words go through normalizeWord, since
+// that is what chirp words are compared in.
+func profaneWordsFromEnv(normalize bool) map[string]struct{} {
+	words := envSet("PROFANITY_WORDS")
+	if len(words) == 0 {
+		return defaultProfaneWords
+	}
+	if !normalize {
+		return words
+	}
+	normalized := make(map[string]struct{}, len(words))
+	for word := range words {
+		normalized[normalizeWord(word)] = struct{}{}
+	}
+	return normalized
+}
+
+// cleanBody masks the words of body that are in badWords, matching them
+// case-insensitively. badWords must be lowercase.
+func cleanBody(body string, badWords map[string]struct{}) string {
+	return maskWords(body, badWords, strings.ToLower)
+}
+
+// cleanBodyNormalized is like cleanBody but also matches visually equivalent
+// variants, such as fullwidth or accented spellings of a profane word.
+func cleanBodyNormalized(body string, badWords map[string]struct{}) string {
+	return maskWords(body, badWords, normalizeWord)
+}
+
+// detectBadWords returns the profane words in body as written, in order of
+// first appearance, using the same matching as the mask functions.
+func detectBadWords(body string, badWords map[string]struct{}, normalize func(string) string) []string {
+	found := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, word := range strings.Fields(body) {
+		if _, ok := badWords[normalize(word)]; !ok {
+			continue
+		}
+		if _, ok := seen[word]; !ok {
+			seen[word] = struct{}{}
+			found = append(found, word)
+		}
+	}
+	return found
+}
+
+func maskWords(body string, badWords map[string]struct{}, normalize func(string) string) string {
+	cleaned := make([]string, 0)
+	for _, word := range strings.Fields(body) {
+		if _, ok := badWords[normalize(word)]; ok {
+			word = "****"
+		}
+		cleaned = append(cleaned, word)
+	}
+	return strings.Join(cleaned, " ")
+}
+
+var foldCase = cases.Fold()
+
+// normalizeWord applies compatibility decomposition, drops combining marks
+// and case-folds word, so "Ｆornax" and "fórnax" both become "fornax".
+func normalizeWord(word string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	s, _, err := transform.String(t, word)
+	if err != nil {
+		s = word
+	}
+	return foldCase.String(s)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       string
+		normalized string
+	}{
+		{
+			name:       "Clean chirp",
+			body:       "I had something interesting for breakfast",
+			want:       "I had something interesting for breakfast",
+			normalized: "I had something interesting for breakfast",
+		},
+		{
+			name:       "Mixed case",
+			body:       "What a KerFuffle that was",
+			want:       "What a **** that was",
+			normalized: "What a **** that was",
+		},
+		{
+			name:       "Fullwidth evasion",
+			body:       "Ｆｏｒｎａｘ again",
+			want:       "Ｆｏｒｎａｘ again",
+			normalized: "**** again",
+		},
+		{
+			name:       "Accented evasion",
+			body:       "sharbért and fórnax",
+			want:       "sharbért and fórnax",
+			normalized: "**** and ****",
+		},
+		{
+			name:       "Combining accent evasion",
+			body:       "kerfúffle",
+			want:       "kerfúffle",
+			normalized: "****",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanBody(tt.body, defaultProfaneWords); got != tt.want {
+				t.Errorf("cleanBody() = %q, want %q", got, tt.want)
+			}
+			if got := cleanBodyNormalized(tt.body, defaultProfaneWords); got != tt.normalized {
+				t.Errorf("cleanBodyNormalized() = %q, want %q", got, tt.normalized)
+			}
+		})
+	}
+}
+
+func TestCleanBodyWordList(t *testing.T) {
+	custom := map[string]struct{}{"heck": {}}
+	tests := []struct {
+		name     string
+		body     string
+		badWords map[string]struct{}
+		want     string
+	}{
+		{
+			name:     "Mixed case",
+			body:     "What the HeCk",
+			badWords: custom,
+			want:     "What the ****",
+		},
+		{
+			name:     "Punctuation-adjacent words are left alone",
+			body:     "heck! what the heck",
+			badWords: custom,
+			want:     "heck! what the ****",
+		},
+		{
+			name:     "Defaults are not used with a custom list",
+			body:     "heck, a kerfuffle",
+			badWords: custom,
+			want:     "heck, a kerfuffle",
+		},
+		{
+			name:     "Empty list",
+			body:     "heck, a kerfuffle",
+			badWords: map[string]struct{}{},
+			want:     "heck, a kerfuffle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanBody(tt.body, tt.badWords); got != tt.want {
+				t.Errorf("cleanBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectBadWords(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       []string
+		normalized []string
+	}{
+		{
+			name:       "Clean chirp",
+			body:       "I had something interesting for breakfast",
+			want:       []string{},
+			normalized: []string{},
+		},
+		{
+			name:       "Repeated word reported once",
+			body:       "Kerfuffle after kerfuffle after Kerfuffle",
+			want:       []string{"Kerfuffle", "kerfuffle"},
+			normalized: []string{"Kerfuffle", "kerfuffle"},
+		},
+		{
+			name:       "Evasions only caught when normalized",
+			body:       "sharbert and fórnax",
+			want:       []string{"sharbert"},
+			normalized: []string{"sharbert", "fórnax"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectBadWords(tt.body, defaultProfaneWords, strings.ToLower); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectBadWords() = %q, want %q", got, tt.want)
+			}
+			if got := detectBadWords(tt.body, defaultProfaneWords, normalizeWord); !reflect.DeepEqual(got, tt.normalized) {
+				t.Errorf("detectBadWords() normalized = %q, want %q", got, tt.normalized)
+			}
+		})
+	}
+}
+
+func TestProfaneWordsFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		words     string
+		normalize bool
+		body      string
+		want      string
+	}{
+		{
+			name:      "Accented word, normalized",
+			words:     "Café",
+			normalize: true,
+			body:      "meet me at the CAFE or the café",
+			want:      "meet me at the **** or the ****",
+		},
+		{
+			name:      "Fold variant, normalized",
+			words:     "straße",
+			normalize: true,
+			body:      "down the STRASSE",
+			want:      "down the ****",
+		},
+		{
+			name:  "Accented word, not normalized",
+			words: "café",
+			body:  "meet me at the CAFÉ or the cafe",
+			want:  "meet me at the **** or the cafe",
+		},
+		{
+			name:      "Unset uses the defaults",
+			normalize: true,
+			body:      "what a kerfuffle",
+			want:      "what a ****",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PROFANITY_WORDS", tt.words)
+			words := profaneWordsFromEnv(tt.normalize)
+			clean := cleanBody
+			if tt.normalize {
+				clean = cleanBodyNormalized
+			}
+			if got := clean(tt.body, words); got != tt.want {
+				t.Errorf("clean(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
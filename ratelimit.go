@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows at most limit events per key within a sliding window.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	rl := &rateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+	go rl.cleanupLoop()
+	return rl
+}
+
+// allow records an event for key and reports whether it is within the limit.
+// When it isn't, the returned duration is how long until the next event
+// would be allowed.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	hits := rl.prune(key, now)
+	if len(hits) >= rl.limit {
+		return false, hits[0].Add(rl.window).Sub(now)
+	}
+	rl.hits[key] = append(hits, now)
+	return true, 0
+}
+
+// prune drops the hits for key that fell out of the window. Callers must
+// hold rl.mu.
+func (rl *rateLimiter) prune(key string, now time.Time) []time.Time {
+	hits := rl.hits[key]
+	i := 0
+	for i < len(hits) && now.Sub(hits[i]) >= rl.window {
+		i++
+	}
+	hits = hits[i:]
+	if len(hits) == 0 {
+		delete(rl.hits, key)
+	} else {
+		rl.hits[key] = hits
+	}
+	return hits
+}
+
+func (rl *rateLimiter) cleanupLoop() {
+	ticker := time.NewTicker(rl.window)
+	defer ticker.Stop()
+	for range ticker.C {
+		rl.mu.Lock()
+		now := time.Now()
+		for key := range rl.hits {
+			rl.prune(key, now)
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// middlewareRateLimit answers requests beyond rl's limit for their client
+// IP with a 429 and a Retry-After header. A nil rl disables it.
+func (cfg *apiConfig) middlewareRateLimit(rl *rateLimiter) middleware {
+	return func(next http.Handler) http.Handler {
+		if rl == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := rl.allow(cfg.clientIP(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				respondWithError(w, http.StatusTooManyRequests, "Too many attempts, try again later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the address of the client that made r. X-Forwarded-For is
+// only honoured when the request came through one of the trusted proxies, in
+// which case the right-most untrusted address is used.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if _, ok := cfg.trustedProxies[ip]; !ok {
+		return ip
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if _, ok := cfg.trustedProxies[hop]; !ok {
+			break
+		}
+	}
+	return ip
+}
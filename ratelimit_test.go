@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := newRateLimiter(5, time.Minute)
+	for i := 0; i < 5; i++ {
+		if ok, _ := rl.allow("203.0.113.7"); !ok {
+			t.Fatalf("login %d was limited, want allowed", i+1)
+		}
+	}
+	ok, retryAfter := rl.allow("203.0.113.7")
+	if ok {
+		t.Fatalf("sixth login was allowed, want limited")
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("retry after = %s, want within (0, 1m]", retryAfter)
+	}
+	if ok, _ := rl.allow("198.51.100.2"); !ok {
+		t.Errorf("login from another IP was limited, want allowed")
+	}
+}
+
+func TestRateLimiterWindowExpires(t *testing.T) {
+	rl := newRateLimiter(1, 20*time.Millisecond)
+	if ok, _ := rl.allow("203.0.113.7"); !ok {
+		t.Fatalf("first login was limited, want allowed")
+	}
+	if ok, _ := rl.allow("203.0.113.7"); ok {
+		t.Fatalf("second login was allowed, want limited")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := rl.allow("203.0.113.7"); !ok {
+		t.Errorf("login after window was limited, want allowed")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := &apiConfig{trustedProxies: map[string]struct{}{"10.0.0.1": {}}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{
+			name:       "Direct client",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted peer can't spoof",
+			remoteAddr: "203.0.113.7:1234",
+			forwarded:  "198.51.100.2",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "1.2.3.4, 198.51.100.2",
+			want:       "198.51.100.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := cfg.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	cfg := &apiConfig{}
+	handler := cfg.middlewareRateLimit(newRateLimiter(5, time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	attempt := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 1; i <= 5; i++ {
+		if rec := attempt("203.0.113.7:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d status = %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+	rec := attempt("203.0.113.7:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("sixth attempt status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("sixth attempt has no Retry-After header")
+	}
+	if rec := attempt("198.51.100.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+// slowQueryLogger wraps a database connection and logs any query that takes
+// longer than threshold, tagged with the sqlc query name and request ID.
+// For QueryContext only the time until the first rows are ready is counted.
+type slowQueryLogger struct {
+	db        database.DBTX
+	threshold time.Duration
+}
+
+func (l *slowQueryLogger) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer l.observe(ctx, query, time.Now())
+	return l.db.ExecContext(ctx, query, args...)
+}
+
+func (l *slowQueryLogger) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return l.db.PrepareContext(ctx, query)
+}
+
+func (l *slowQueryLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer l.observe(ctx, query, time.Now())
+	return l.db.QueryContext(ctx, query, args...)
+}
+
+func (l *slowQueryLogger) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer l.observe(ctx, query, time.Now())
+	return l.db.QueryRowContext(ctx, query, args...)
+}
+
+func (l *slowQueryLogger) observe(ctx context.Context, query string, start time.Time) {
+	if elapsed := time.Since(start); elapsed >= l.threshold {
+		id, _ := ctx.Value(requestIDKey).(string)
+		log.Printf("[%s] slow query %s took %s", id, queryName(query), elapsed)
+	}
+}
+
+// queryName returns the name from sqlc's "-- name: X :kind" header.
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "unnamed"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
+
+// newQueries returns queries bound to db, timed when SLOW_QUERY_MS is set.
+func (cfg *apiConfig) newQueries(db database.DBTX) *database.Queries {
+	if cfg.slowQueryThreshold > 0 {
+		db = &slowQueryLogger{db: db, threshold: cfg.slowQueryThreshold}
+	}
+	return database.New(db)
+}
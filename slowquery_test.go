@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "sqlc query",
+			query: "-- name: GetChirpByID :one\nSELECT id FROM chirps\n",
+			want:  "GetChirpByID",
+		},
+		{
+			name:  "Raw query",
+			query: "SELECT 1",
+			want:  "unnamed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryName(tt.query); got != tt.want {
+				t.Errorf("queryName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// sleepyDB is a DBTX whose Exec takes delay.
+type sleepyDB struct{ delay time.Duration }
+
+func (d sleepyDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	time.Sleep(d.delay)
+	return nil, nil
+}
+func (d sleepyDB) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, nil }
+func (d sleepyDB) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+func (d sleepyDB) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+
+func TestSlowQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		wantLog bool
+	}{
+		{
+			name:    "Fast query",
+			delay:   0,
+			wantLog: false,
+		},
+		{
+			name:    "Slow query",
+			delay:   30 * time.Millisecond,
+			wantLog: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			l := &slowQueryLogger{db: sleepyDB{tt.delay}, threshold: 20 * time.Millisecond}
+			ctx := context.WithValue(context.Background(), requestIDKey, "req-123")
+			l.ExecContext(ctx, "-- name: DeleteAllChirps :execrows\nDELETE FROM chirps\n")
+			out := buf.String()
+			if got := strings.Contains(out, "slow query DeleteAllChirps"); got != tt.wantLog {
+				t.Errorf("logged = %v, want %v (output %q)", got, tt.wantLog, out)
+			}
+			if tt.wantLog && !strings.Contains(out, "req-123") {
+				t.Errorf("log %q is missing the request ID", out)
+			}
+		})
+	}
+}
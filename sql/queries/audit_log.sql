@@ -0,0 +1,17 @@
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (id, created_at, actor_id, action, target_id, ip)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+WHERE (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+  AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
\ No newline at end of file
@@ -1,11 +1,14 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, is_sensitive, quoted_chirp_id, publish_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
 RETURNING *;
 
@@ -13,18 +16,90 @@ RETURNING *;
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[])
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active);
+
 -- name: GetAllChirps :many
 SELECT * FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
 ORDER BY created_at ASC;
 
+-- name: GetRecentChirps :many
+SELECT * FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: GetRecentChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit);
+
 -- name: GetChirpsByAuthor :many
 SELECT * FROM chirps
-WHERE user_id = $1
+WHERE user_id = $1 AND (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
 ORDER BY created_at ASC;
 
+-- name: GetChirpsByAuthorPage :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamptz, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetFeedChirps :many
+SELECT * FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+  AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id))
+  AND (NOT sqlc.arg(exclude_sensitive)::bool OR NOT is_sensitive)
+  AND (sqlc.narg(before_created_at)::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.narg(before_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetChirpsPaginated :many
+SELECT * FROM chirps
+WHERE (publish_at IS NULL OR publish_at <= NOW())
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+  AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id))
+  AND (NOT sqlc.arg(exclude_sensitive)::bool OR NOT is_sensitive)
+  AND (sqlc.narg(after_created_at)::timestamptz IS NULL
+    OR (created_at, id) > (sqlc.narg(after_created_at), sqlc.narg(after_id)::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
--- name: DeleteAllChirps :exec
-DELETE FROM chirps *;
\ No newline at end of file
+-- name: DeleteAllChirps :execrows
+DELETE FROM chirps *;
+
+-- name: GetTrendingHashtags :many
+SELECT LOWER(m[2])::text AS tag,
+       COUNT(*) AS uses,
+       SUM(1 - EXTRACT(EPOCH FROM NOW() - COALESCE(chirps.publish_at, chirps.created_at)) / sqlc.arg(window_seconds)::float8)::float8 AS score
+FROM chirps, regexp_matches(chirps.body, '(^|\s)#([[:alnum:]_]+)', 'g') AS m
+WHERE COALESCE(chirps.publish_at, chirps.created_at) > NOW() - make_interval(secs => sqlc.arg(window_seconds))
+  AND COALESCE(chirps.publish_at, chirps.created_at) <= NOW()
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.is_active)
+GROUP BY tag
+ORDER BY score DESC, tag ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: DeleteChirpsByUser :exec
+DELETE FROM chirps
+WHERE user_id = $1;
\ No newline at end of file
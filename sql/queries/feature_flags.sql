@@ -0,0 +1,14 @@
+-- name: ListFeatureFlags :many
+SELECT * FROM feature_flags
+ORDER BY name ASC;
+
+-- name: SetFeatureFlag :one
+INSERT INTO feature_flags (name, enabled, updated_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (name) DO UPDATE
+SET enabled = EXCLUDED.enabled, updated_at = NOW()
+RETURNING *;
\ No newline at end of file
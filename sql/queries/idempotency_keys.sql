@@ -0,0 +1,22 @@
+-- name: CreateIdempotencyKey :execrows
+INSERT INTO idempotency_keys (key, user_id, chirp_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4
+)
+ON CONFLICT (user_id, key) DO UPDATE
+SET chirp_id = EXCLUDED.chirp_id,
+    created_at = EXCLUDED.created_at,
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= NOW();
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE user_id = $1 AND key = $2 AND expires_at > NOW();
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= NOW();
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token, created_at, user_id, expires_at)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
\ No newline at end of file
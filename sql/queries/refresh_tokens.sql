@@ -19,5 +19,24 @@ SET revoked_at = NOW(), updated_at = NOW()
 WHERE token = $1
 RETURNING *;
 
--- name: DeleteAllRefreshTokens :exec
-DELETE FROM refresh_tokens *;
\ No newline at end of file
+-- name: RevokeAllRefreshTokensForUser :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListRefreshTokens :many
+SELECT * FROM refresh_tokens
+WHERE (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+  AND (sqlc.arg(state)::text = 'all'
+    OR (sqlc.arg(state) = 'active' AND revoked_at IS NULL AND expires_at > NOW())
+    OR (sqlc.arg(state) = 'revoked' AND revoked_at IS NOT NULL)
+    OR (sqlc.arg(state) = 'expired' AND revoked_at IS NULL AND expires_at <= NOW()))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: DeleteAllRefreshTokens :execrows
+DELETE FROM refresh_tokens *;
+
+-- name: DeleteRefreshTokensForUser :exec
+DELETE FROM refresh_tokens
+WHERE user_id = $1;
\ No newline at end of file
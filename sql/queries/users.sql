@@ -11,7 +11,15 @@ RETURNING *;
 
 -- name: GetUserByEmail :one
 SELECT * FROM users
-WHERE email = $1;
+WHERE LOWER(email) = LOWER(sqlc.arg(email));
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUsersByIDs :many
+SELECT * FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
 
 -- name: GetUserFromRefreshToken :one
 SELECT * FROM users
@@ -20,15 +28,37 @@ WHERE id = (SELECT user_id FROM refresh_tokens
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW()
-WHERE id = $3
+SET email = COALESCE(sqlc.narg(email), email),
+    hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
 RETURNING *;
 
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
+
 -- name: UpgradeUser :one
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
 RETURNING *;
 
--- name: DeleteAllUsers :exec
-DELETE FROM users *;
\ No newline at end of file
+-- name: UpgradeUsers :many
+UPDATE users
+SET is_chirpy_red = true
+WHERE id = ANY(sqlc.arg(ids)::uuid[])
+RETURNING id;
+
+-- name: SetUserActive :exec
+UPDATE users
+SET is_active = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: DeleteAllUsers :execrows
+DELETE FROM users *;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN is_sensitive BOOLEAN NOT NULL
+DEFAULT false;
+
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN is_sensitive;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- No foreign key: a quote outlives the chirp it quotes, and responses
+-- render a placeholder once the quoted chirp is gone.
+ALTER TABLE chirps
+ADD COLUMN quoted_chirp_id UUID;
+
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN quoted_chirp_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Resolve existing case-variant duplicates first: the oldest account keeps
+-- the address and the others get a unique suffix so they can be merged or
+-- contacted manually.
+UPDATE users
+SET email = email || '.duplicate-' || id, updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY LOWER(email) ORDER BY created_at, id) AS rn
+        FROM users
+    ) ranked
+    WHERE rn > 1
+);
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (LOWER(email));
+
+-- +goose Down
+DROP INDEX users_email_lower_idx;
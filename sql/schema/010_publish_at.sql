@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMP WITH TIME ZONE;
+
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN publish_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE feature_flags(
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE feature_flags;
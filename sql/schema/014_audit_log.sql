@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE audit_log(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    actor_id UUID,
+    action TEXT NOT NULL,
+    target_id UUID,
+    ip TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at DESC);
+
+-- +goose Down
+DROP TABLE audit_log;
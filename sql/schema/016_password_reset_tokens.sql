@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens(
+    token TEXT PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
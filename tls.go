@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfigFromEnv builds the server TLS configuration from TLS_CERT_FILE,
+// TLS_KEY_FILE, TLS_MIN_VERSION and TLS_CIPHER_SUITES. It returns nil when
+// neither file is set, so the server falls back to plain HTTP, and an error
+// when only one is or they don't form a key pair. Unset tuning values keep
+// Go's secure defaults.
+func tlsConfigFromEnv() (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load TLS key pair: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if v := os.Getenv("TLS_MIN_VERSION"); v != "" {
+		version, ok := tlsVersions[v]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS_MIN_VERSION %q", v)
+		}
+		cfg.MinVersion = version
+	}
+
+	if v := os.Getenv("TLS_CIPHER_SUITES"); v != "" {
+		known := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			known[suite.Name] = suite.ID
+		}
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			id, ok := known[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure cipher suite %q in TLS_CIPHER_SUITES", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self-signed certificate and its key to dir and
+// returns their paths.
+func writeKeyPair(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfigFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "server")
+	_, otherKey := writeKeyPair(t, dir, "other")
+
+	tests := []struct {
+		name            string
+		env             map[string]string
+		wantNil         bool
+		wantErr         bool
+		wantMinVersion  uint16
+		wantCipherSuite []uint16
+	}{
+		{
+			name:    "TLS not configured",
+			wantNil: true,
+		},
+		{
+			name: "Certificate and key",
+			env:  map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile},
+		},
+		{
+			name:    "Certificate without key",
+			env:     map[string]string{"TLS_CERT_FILE": certFile},
+			wantErr: true,
+		},
+		{
+			name:    "Key without certificate",
+			env:     map[string]string{"TLS_KEY_FILE": keyFile},
+			wantErr: true,
+		},
+		{
+			name:    "Mismatched key",
+			env:     map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": otherKey},
+			wantErr: true,
+		},
+		{
+			name:    "Missing file",
+			env:     map[string]string{"TLS_CERT_FILE": filepath.Join(dir, "missing.crt"), "TLS_KEY_FILE": keyFile},
+			wantErr: true,
+		},
+		{
+			name:           "Minimum version",
+			env:            map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile, "TLS_MIN_VERSION": "1.3"},
+			wantMinVersion: tls.VersionTLS13,
+		},
+		{
+			name:    "Unknown minimum version",
+			env:     map[string]string{"TLS_CERT_FILE": certFile, "TLS_KEY_FILE": keyFile, "TLS_MIN_VERSION": "TLSv1.3"},
+			wantErr: true,
+		},
+		{
+			name: "Cipher suites",
+			env: map[string]string{
+				"TLS_CERT_FILE":     certFile,
+				"TLS_KEY_FILE":      keyFile,
+				"TLS_CIPHER_SUITES": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+			},
+			wantCipherSuite: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+		},
+		{
+			name: "Insecure cipher suite",
+			env: map[string]string{
+				"TLS_CERT_FILE":     certFile,
+				"TLS_KEY_FILE":      keyFile,
+				"TLS_CIPHER_SUITES": "TLS_RSA_WITH_RC4_128_SHA",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_MIN_VERSION", "TLS_CIPHER_SUITES"} {
+				t.Setenv(key, tt.env[key])
+			}
+			got, err := tlsConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tlsConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("tlsConfigFromEnv() = %v, want nil %v", got, tt.wantNil)
+			}
+			if got == nil {
+				return
+			}
+			if len(got.Certificates) != 1 {
+				t.Errorf("Certificates = %d, want 1", len(got.Certificates))
+			}
+			if got.MinVersion != tt.wantMinVersion {
+				t.Errorf("MinVersion = %#x, want %#x", got.MinVersion, tt.wantMinVersion)
+			}
+			if !slices.Equal(got.CipherSuites, tt.wantCipherSuite) {
+				t.Errorf("CipherSuites = %v, want %v", got.CipherSuites, tt.wantCipherSuite)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+// withTx runs fn inside a database transaction, committing if it returns nil
+// and rolling back otherwise, so multi-write operations are all-or-nothing.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(cfg.newQueries(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("couldn't commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+func TestWithTxCommits(t *testing.T) {
+	d := &txRecorder{}
+	cfg := newTxTestConfig(t, d)
+
+	err := cfg.withTx(context.Background(), func(q *database.Queries) error {
+		if _, err := q.DeleteAllUsers(context.Background()); err != nil {
+			return err
+		}
+		_, err := q.DeleteAllChirps(context.Background())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("withTx() error = %v", err)
+	}
+	if d.commits != 1 || d.rollbacks != 0 {
+		t.Errorf("commits = %d, rollbacks = %d, want 1 and 0", d.commits, d.rollbacks)
+	}
+}
+
+func TestWithTxRollsBackMidTransaction(t *testing.T) {
+	d := &txRecorder{failQuery: deleteAllChirpsQuery}
+	cfg := newTxTestConfig(t, d)
+
+	err := cfg.withTx(context.Background(), func(q *database.Queries) error {
+		if _, err := q.DeleteAllUsers(context.Background()); err != nil {
+			return err
+		}
+		_, err := q.DeleteAllChirps(context.Background())
+		return err
+	})
+	if err == nil {
+		t.Fatalf("withTx() error = nil, want forced failure")
+	}
+	if len(d.execs) != 1 {
+		t.Errorf("execs = %d, want the first write to have run", len(d.execs))
+	}
+	if d.commits != 0 || d.rollbacks != 1 {
+		t.Errorf("commits = %d, rollbacks = %d, want 0 and 1", d.commits, d.rollbacks)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+// User is the public view of a user. Exactly one of IsChirpyRed and
+// Subscription is set, depending on the response format the client asked
+// for.
+type User struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Email        string        `json:"email"`
+	IsChirpyRed  *bool         `json:"is_chirpy_red,omitempty"`
+	Subscription *Subscription `json:"subscription,omitempty"`
+	Token        string        `json:"token,omitempty"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
+	Chirps       []Chirp       `json:"chirps,omitempty"`
+}
+
+// userResponseOpts selects the optional parts of a User response.
+type userResponseOpts struct {
+	// V2 emits the subscription object instead of is_chirpy_red.
+	V2           bool
+	Token        string
+	RefreshToken string
+	Chirps       []Chirp
+}
+
+// Subscription replaces the flat is_chirpy_red flag in the v2 format.
+type Subscription struct {
+	Tier   string `json:"tier"`
+	Active bool   `json:"active"`
+}
+
+// wantsV2 reports whether the client asked for the v2 response format,
+// either with ?format=v2 or an Accept-Version: 2 header.
+func wantsV2(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "v2" {
+		return true
+	}
+	switch r.Header.Get("Accept-Version") {
+	case "2", "v2":
+		return true
+	}
+	return false
+}
+
+// userToResponse converts a database user into its public shape. All user
+// responses go through here so fields can't drift between endpoints and the
+// password hash can never leak into one.
+func userToResponse(usr database.User, opts userResponseOpts) User {
+	res := User{
+		ID:           usr.ID,
+		CreatedAt:    usr.CreatedAt,
+		UpdatedAt:    usr.UpdatedAt,
+		Email:        usr.Email,
+		Token:        opts.Token,
+		RefreshToken: opts.RefreshToken,
+		Chirps:       opts.Chirps,
+	}
+	if opts.V2 {
+		res.Subscription = &Subscription{Tier: "red", Active: usr.IsChirpyRed}
+	} else {
+		res.IsChirpyRed = &usr.IsChirpyRed
+	}
+	return res
+}
+
+// normalizeEmail trims and lowercases an email address before it's stored.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// isValidEmail reports whether email is a bare address like
+// user@example.com, without a display name or angle brackets.
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// minPasswordLength is the shortest password accepted, in characters.
+const minPasswordLength = 8
+
+// validatePassword checks pw against the password rules, naming every rule
+// it breaks.
+func validatePassword(pw string) error {
+	var failed []string
+	if utf8.RuneCountInString(pw) < minPasswordLength {
+		failed = append(failed, fmt.Sprintf("be at least %d characters long", minPasswordLength))
+	}
+	if !strings.ContainsFunc(pw, unicode.IsDigit) {
+		failed = append(failed, "contain at least one digit")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("password must %s", strings.Join(failed, " and "))
+	}
+	return nil
+}
+
+// handlerGetUserByID returns a user's public profile. Deactivated accounts
+// are reported as not found, like their chirps.
+func (cfg *apiConfig) handlerGetUserByID(w http.ResponseWriter, r *http.Request) {
+	uid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	usr, err := cfg.readQueries.GetUserByID(r.Context(), uid)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !usr.IsActive) {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondInternal(w, r, fmt.Errorf("couldn't get user: %w", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userToResponse(usr, userResponseOpts{V2: wantsV2(r)}))
+}
+
+// deleteUser removes a user together with their chirps and refresh tokens
+// in one transaction, so a failure part way through deletes nothing.
+func (cfg *apiConfig) deleteUser(ctx context.Context, id uuid.UUID) error {
+	return cfg.withTx(ctx, func(q *database.Queries) error {
+		if err := q.DeleteRefreshTokensForUser(ctx, id); err != nil {
+			return fmt.Errorf("couldn't delete refresh tokens: %w", err)
+		}
+		if err := q.DeleteChirpsByUser(ctx, id); err != nil {
+			return fmt.Errorf("couldn't delete chirps: %w", err)
+		}
+		if err := q.DeleteUser(ctx, id); err != nil {
+			return fmt.Errorf("couldn't delete user: %w", err)
+		}
+		return nil
+	})
+}
+
+// handlerDeleteUser permanently deletes the authenticated user's account.
+func (cfg *apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userid, err := cfg.authenticateUser(r)
+	if err != nil {
+		respondAuthError(w, r, err)
+		return
+	}
+	if err := cfg.deleteUser(r.Context(), userid); err != nil {
+		respondInternal(w, r, err)
+		return
+	}
+	cfg.audit(r, userid, auditAccountDelete, userid)
+	respondWithJSON(w, http.StatusNoContent, struct{}{})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordvorath/chirpy/internal/auth"
+	"github.com/lordvorath/chirpy/internal/database"
+)
+
+func TestNewUserFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		version string
+		want    string
+	}{
+		{
+			name:   "Default is flat",
+			target: "/api/users",
+			want:   `"is_chirpy_red":true}`,
+		},
+		{
+			name:   "Format query parameter",
+			target: "/api/users?format=v2",
+			want:   `"subscription":{"tier":"red","active":true}}`,
+		},
+		{
+			name:    "Accept-Version header",
+			target:  "/api/users",
+			version: "2",
+			want:    `"subscription":{"tier":"red","active":true}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.version != "" {
+				r.Header.Set("Accept-Version", tt.version)
+			}
+			usr := database.User{Email: "a@example.com", HashedPassword: "hash", IsChirpyRed: true}
+			data, err := json.Marshal(userToResponse(usr, userResponseOpts{V2: wantsV2(r)}))
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if !strings.HasSuffix(string(data), tt.want) {
+				t.Errorf("userToResponse() = %s, want suffix %s", data, tt.want)
+			}
+			if strings.Contains(string(data), "hash") {
+				t.Errorf("userToResponse() = %s, leaks the password hash", data)
+			}
+		})
+	}
+}
+
+func TestGetUserByID(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	userID := store.seedUser("user@example.com")
+
+	tests := []struct {
+		name       string
+		userID     string
+		wantStatus int
+	}{
+		{
+			name:       "Existing user",
+			userID:     userID.String(),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Unknown user",
+			userID:     uuid.NewString(),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Malformed id",
+			userID:     "not-a-uuid",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users/"+tt.userID, nil)
+			req.SetPathValue("userID", tt.userID)
+			rec := httptest.NewRecorder()
+			cfg.handlerGetUserByID(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			body := rec.Body.String()
+			if strings.Contains(body, "secrethash") || strings.Contains(body, "password") {
+				t.Errorf("body = %s, leaks the password hash", body)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(body, `"email":"user@example.com"`) {
+				t.Errorf("body = %s, want the user's profile", body)
+			}
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		pw      string
+		wantErr string
+	}{
+		{
+			name:    "Valid",
+			pw:      "hunter42!",
+			wantErr: "",
+		},
+		{
+			name:    "Too short",
+			pw:      "abc1",
+			wantErr: "password must be at least 8 characters long",
+		},
+		{
+			name:    "No digit",
+			pw:      "correcthorse",
+			wantErr: "password must contain at least one digit",
+		},
+		{
+			name:    "Empty",
+			pw:      "",
+			wantErr: "password must be at least 8 characters long and contain at least one digit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePassword(tt.pw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePassword() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validatePassword() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsValidEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		want  string
+		valid bool
+	}{
+		{
+			name:  "Valid address",
+			email: "user@example.com",
+			want:  "user@example.com",
+			valid: true,
+		},
+		{
+			name:  "Missing @",
+			email: "notanemail",
+			want:  "notanemail",
+			valid: false,
+		},
+		{
+			name:  "Mixed case and whitespace",
+			email: "  User@Example.COM ",
+			want:  "user@example.com",
+			valid: true,
+		},
+		{
+			name:  "Display name",
+			email: "User <user@example.com>",
+			want:  "user <user@example.com>",
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeEmail(tt.email)
+			if got != tt.want {
+				t.Errorf("normalizeEmail() = %q, want %q", got, tt.want)
+			}
+			if valid := isValidEmail(got); valid != tt.valid {
+				t.Errorf("isValidEmail(%q) = %v, want %v", got, valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestHandlerDeleteUserIsAtomic(t *testing.T) {
+	tests := []struct {
+		name          string
+		failQuery     string
+		noToken       bool
+		wantStatus    int
+		wantCommits   int
+		wantRollbacks int
+	}{
+		{
+			name:          "All deletes succeed",
+			wantStatus:    http.StatusNoContent,
+			wantCommits:   1,
+			wantRollbacks: 0,
+		},
+		{
+			name:          "Chirp delete fails",
+			failQuery:     "-- name: DeleteChirpsByUser :exec\nDELETE FROM chirps\nWHERE user_id = $1\n",
+			wantStatus:    http.StatusInternalServerError,
+			wantCommits:   0,
+			wantRollbacks: 1,
+		},
+		{
+			name:          "Missing token",
+			noToken:       true,
+			wantStatus:    http.StatusUnauthorized,
+			wantCommits:   0,
+			wantRollbacks: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &txRecorder{failQuery: tt.failQuery, user: uuid.New()}
+			cfg := newTxTestConfig(t, d)
+			cfg.secret = "secret"
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/users", nil)
+			if !tt.noToken {
+				token, _ := auth.MakeJWT(d.user, cfg.secret, time.Hour)
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerDeleteUser(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if d.commits != tt.wantCommits || d.rollbacks != tt.wantRollbacks {
+				t.Errorf("commits = %d, rollbacks = %d, want %d and %d", d.commits, d.rollbacks, tt.wantCommits, tt.wantRollbacks)
+			}
+		})
+	}
+}
@@ -1,11 +1,130 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// envDuration parses the environment variable key as a time.Duration,
+// falling back to def when it is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("warning: invalid %s %q, using default %s: %s", key, val, def, err)
+		return def
+	}
+	return d
+}
+
+// envSet parses the environment variable key as a comma-separated list and
+// returns its lowercased, trimmed entries as a set.
+func envSet(key string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			set[item] = struct{}{}
+		}
+	}
+	return set
+}
+
+// envInt parses the environment variable key as an int, falling back to def
+// when it is unset or invalid.
+func envInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("warning: invalid %s %q, using default %d: %s", key, val, def, err)
+		return def
+	}
+	return n
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a write that
+// would break a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// checkMaxLength returns an error naming field when value is longer than
+// max characters.
+func checkMaxLength(field, value string, max int) error {
+	if n := utf8.RuneCountInString(value); n > max {
+		return fmt.Errorf("%s is too long (%d characters, maximum is %d)", field, n, max)
+	}
+	return nil
+}
+
+// parseSort reads the sort query parameter and reports whether it asks for
+// newest first. It defaults to asc; anything but asc or desc is an error.
+func parseSort(r *http.Request) (bool, error) {
+	switch v := r.URL.Query().Get("sort"); v {
+	case "", "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid sort %q: must be asc or desc", v)
+	}
+}
+
+// parseLimit reads the limit query parameter, applying defaultLimit when it
+// is absent and capping it at maxLimit.
+func parseLimit(r *http.Request, defaultLimit, maxLimit int) (int32, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return int32(defaultLimit), nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid limit %q", v)
+	}
+	return int32(min(n, maxLimit)), nil
+}
+
+// parsePagination reads the limit and offset query parameters, applying
+// defaultLimit when limit is absent and capping it at maxLimit.
+func parsePagination(r *http.Request, defaultLimit, maxLimit int) (int32, int32, error) {
+	limit, err := parseLimit(r, defaultLimit, maxLimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	var offset int32
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", v)
+		}
+		offset = int32(n)
+	}
+	return limit, offset, nil
+}
+
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cfg.fileserverHits.Add(1)
@@ -13,6 +132,95 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// middleware wraps a handler with extra behaviour.
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in middlewares so that the first one listed runs first:
+// chain(h, a, b) is a(b(h)).
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// middlewareMaxBytes caps request bodies at limit bytes; reads past it fail
+// with an *http.MaxBytesError.
+func middlewareMaxBytes(limit int64) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (cfg *apiConfig) middlewareCSP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", cfg.contentSecurityPolicy)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// middlewareTrailingSlash makes /api/chirps/ resolve like /api/chirps, either
+// by redirecting (mode "redirect") or by rewriting the path in place (mode
+// "rewrite"). The file server under /app/ relies on its trailing slash and
+// is left alone.
+func middlewareTrailingSlash(mode string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if len(path) <= 1 || !strings.HasSuffix(path, "/") || strings.HasPrefix(path, "/app/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			trimmed := strings.TrimRight(path, "/")
+			if trimmed == "" {
+				trimmed = "/"
+			}
+			if mode == "redirect" {
+				u := *r.URL
+				u.Path = trimmed
+				u.RawPath = ""
+				// 308 so clients repeat POST/PUT/DELETE bodies on the new URL.
+				http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+				return
+			}
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = trimmed
+			r2.URL.RawPath = ""
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+func respondInternal(w http.ResponseWriter, r *http.Request, err error) {
+	id := requestID(r)
+	log.Printf("internal error (request %s): %s", id, err)
+	type internal struct {
+		Error     string `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	respondWithJSON(w, http.StatusInternalServerError, internal{Error: "internal server error", RequestID: id})
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string) {
 	type invalid struct {
 		Error string `json:"error"`
@@ -23,7 +231,10 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 func respondWithJSON(w http.ResponseWriter, code int, payload any) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("error marshalling json")
+		log.Printf("error marshalling json: %s", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"internal server error"}`))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
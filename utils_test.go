@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckMaxLength(t *testing.T) {
+	domain := "@example.com"
+	atLimit := strings.Repeat("a", 254-len(domain)) + domain
+
+	tests := []struct {
+		name    string
+		value   string
+		max     int
+		wantErr bool
+	}{
+		{
+			name:    "Short email",
+			value:   "user@example.com",
+			max:     254,
+			wantErr: false,
+		},
+		{
+			name:    "Exactly at limit",
+			value:   atLimit,
+			max:     254,
+			wantErr: false,
+		},
+		{
+			name:    "One over limit",
+			value:   "a" + atLimit,
+			max:     254,
+			wantErr: true,
+		},
+		{
+			name:    "Multi-byte characters count once",
+			value:   "ééé",
+			max:     3,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMaxLength("email", tt.value, tt.max)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMaxLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTrailingSlash(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+
+	tests := []struct {
+		name         string
+		mode         string
+		target       string
+		wantStatus   int
+		wantPath     string
+		wantLocation string
+	}{
+		{
+			name:       "Rewrite trailing slash",
+			mode:       "rewrite",
+			target:     "/api/chirps/",
+			wantStatus: http.StatusOK,
+			wantPath:   "/api/chirps",
+		},
+		{
+			name:         "Redirect trailing slash",
+			mode:         "redirect",
+			target:       "/api/chirps/?sort=desc",
+			wantStatus:   http.StatusPermanentRedirect,
+			wantLocation: "/api/chirps?sort=desc",
+		},
+		{
+			name:       "No trailing slash",
+			mode:       "redirect",
+			target:     "/api/chirps",
+			wantStatus: http.StatusOK,
+			wantPath:   "/api/chirps",
+		},
+		{
+			name:       "File server untouched",
+			mode:       "rewrite",
+			target:     "/app/",
+			wantStatus: http.StatusOK,
+			wantPath:   "/app/",
+		},
+		{
+			name:       "Root untouched",
+			mode:       "redirect",
+			target:     "/",
+			wantStatus: http.StatusOK,
+			wantPath:   "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			middlewareTrailingSlash(tt.mode)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantLocation != "" {
+				if got := rec.Header().Get("Location"); got != tt.wantLocation {
+					t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+				}
+				return
+			}
+			if got := rec.Body.String(); got != tt.wantPath {
+				t.Errorf("path = %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mark("first"), mark("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(order, ","); got != "first,second,handler" {
+		t.Errorf("order = %s, want first,second,handler", got)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	errMissingSignature = errors.New("webhook signature is missing")
+	errBadSignature     = errors.New("webhook signature does not match")
+	errStaleWebhook     = errors.New("webhook timestamp is missing or outside the allowed window")
+	errMissingNonce     = errors.New("webhook nonce is missing")
+	errReplayedWebhook  = errors.New("webhook nonce has already been used")
+)
+
+// nonceStore remembers webhook nonces for the replay window so a captured
+// request can't be delivered twice.
+type nonceStore struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func newNonceStore(window time.Duration) *nonceStore {
+	return &nonceStore{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// checkReplay validates the X-Webhook-Timestamp and X-Webhook-Nonce headers
+// of a webhook request, recording the nonce when it is accepted. Callers
+// release the nonce again if they then fail to process the webhook.
+func (ns *nonceStore) checkReplay(headers http.Header) error {
+	ts, err := strconv.ParseInt(headers.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		return errStaleWebhook
+	}
+	now := time.Now()
+	sent := time.Unix(ts, 0)
+	if now.Sub(sent) > ns.window || sent.Sub(now) > ns.window {
+		return errStaleWebhook
+	}
+	nonce := headers.Get("X-Webhook-Nonce")
+	if nonce == "" {
+		return errMissingNonce
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	for n, at := range ns.seen {
+		if now.Sub(at) > 2*ns.window {
+			delete(ns.seen, n)
+		}
+	}
+	if _, ok := ns.seen[nonce]; ok {
+		return errReplayedWebhook
+	}
+	ns.seen[nonce] = now
+	return nil
+}
+
+// release forgets the nonce of a webhook that checkReplay accepted but we
+// then failed to process, so the provider's retry isn't taken for a replay.
+func (ns *nonceStore) release(headers http.Header) {
+	if ns == nil {
+		return
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	delete(ns.seen, headers.Get("X-Webhook-Nonce"))
+}
+
+// signWebhook returns the hex-encoded HMAC-SHA256, keyed with key, of
+// timestamp + "." + nonce + "." + body. The replay headers are part of the
+// signed payload so a captured webhook can't be resent with fresh ones.
+// Without either header only the raw body is signed, for providers that
+// don't send them.
+func signWebhook(timestamp, nonce string, body []byte, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	if timestamp != "" || nonce != "" {
+		mac.Write([]byte(timestamp + "." + nonce + "."))
+	}
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhookSignature checks the X-Polka-Signature header of a webhook
+// against signWebhook over its X-Webhook-Timestamp and X-Webhook-Nonce
+// headers and raw body.
+func verifyWebhookSignature(headers http.Header, body []byte, key string) error {
+	signature := headers.Get("X-Polka-Signature")
+	if signature == "" {
+		return errMissingSignature
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errBadSignature
+	}
+	want, _ := hex.DecodeString(signWebhook(headers.Get("X-Webhook-Timestamp"), headers.Get("X-Webhook-Nonce"), body, key))
+	if !hmac.Equal(got, want) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// webhookEvent is the only payload shape Polka sends us.
+type webhookEvent struct {
+	Event string `json:"event"`
+	Data  struct {
+		UserID string `json:"user_id"`
+	} `json:"data"`
+}
+
+// decodeWebhook strictly decodes a webhook body: unknown fields, which is
+// where deeply nested or oversized junk would hide, and trailing data are
+// rejected rather than parsed.
+func decodeWebhook(body io.Reader) (webhookEvent, error) {
+	var event webhookEvent
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&event); err != nil {
+		return webhookEvent{}, err
+	}
+	if dec.More() {
+		return webhookEvent{}, fmt.Errorf("unexpected data after webhook payload")
+	}
+	return event, nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{
+			name:    "Expected shape",
+			body:    `{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`,
+			wantErr: false,
+		},
+		{
+			name:    "Unknown top-level field",
+			body:    `{"event":"user.upgraded","extra":[[[[[]]]]],"data":{"user_id":"x"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown nested field",
+			body:    `{"event":"user.upgraded","data":{"user_id":"x","more":{"a":{"b":{}}}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Trailing data",
+			body:    `{"event":"user.upgraded","data":{"user_id":"x"}} {"event":"again"}`,
+			wantErr: true,
+		},
+		{
+			name:    "Wrong type",
+			body:    `{"event":["user.upgraded"]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeWebhook(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpgradeUserSignature(t *testing.T) {
+	// signature functions get the timestamp and nonce headers actually sent.
+	signed := func(key string) func(ts, nonce, body string) string {
+		return func(ts, nonce, body string) string { return signWebhook(ts, nonce, []byte(body), key) }
+	}
+	tests := []struct {
+		name         string
+		allowAPIKey  bool
+		noReplay     bool
+		signature    func(ts, nonce, body string) string
+		apiKey       string
+		delivered    bool
+		wantStatus   int
+		wantUpgraded bool
+	}{
+		{
+			name:         "Correctly signed",
+			signature:    signed("polka"),
+			wantStatus:   http.StatusNoContent,
+			wantUpgraded: true,
+		},
+		{
+			name:       "Signed with the wrong key",
+			signature:  signed("other"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Signature of a different body",
+			signature: func(ts, nonce, body string) string {
+				return signWebhook(ts, nonce, []byte(body+" "), "polka")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Replay with a fresh timestamp and nonce",
+			signature: func(ts, nonce, body string) string {
+				old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+				return signWebhook(old, "captured-nonce", []byte(body), "polka")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Replay with the original headers",
+			signature:  signed("polka"),
+			delivered:  true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:     "Body-only signature without replay headers",
+			noReplay: true,
+			signature: func(ts, nonce, body string) string {
+				mac := hmac.New(sha256.New, []byte("polka"))
+				mac.Write([]byte(body))
+				return hex.EncodeToString(mac.Sum(nil))
+			},
+			wantStatus:   http.StatusNoContent,
+			wantUpgraded: true,
+		},
+		{
+			name: "Body-only signature with replay headers",
+			signature: func(ts, nonce, body string) string {
+				return signWebhook("", "", []byte(body), "polka")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "API key without fallback",
+			apiKey:     "polka",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "API key with fallback",
+			allowAPIKey:  true,
+			apiKey:       "polka",
+			wantStatus:   http.StatusNoContent,
+			wantUpgraded: true,
+		},
+		{
+			name:        "Bad signature is not rescued by the fallback",
+			allowAPIKey: true,
+			signature:   func(ts, nonce, body string) string { return "deadbeef" },
+			apiKey:      "polka",
+			wantStatus:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store := newChirpStoreConfig(t)
+			cfg.polka_key = "polka"
+			cfg.polkaAllowAPIKey = tt.allowAPIKey
+			userID := store.seedUser("user@example.com")
+
+			body := `{"event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`
+			var ts, nonce string
+			headers := http.Header{}
+			if !tt.noReplay {
+				cfg.webhookNonces = newNonceStore(5 * time.Minute)
+				ts, nonce = strconv.FormatInt(time.Now().Unix(), 10), "nonce-1"
+				headers.Set("X-Webhook-Timestamp", ts)
+				headers.Set("X-Webhook-Nonce", nonce)
+			}
+			if tt.delivered {
+				if err := cfg.webhookNonces.checkReplay(headers); err != nil {
+					t.Fatalf("checkReplay() on first delivery error = %v", err)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(body))
+			req.Header = headers
+			if tt.signature != nil {
+				req.Header.Set("X-Polka-Signature", tt.signature(ts, nonce, body))
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("Authorization", "ApiKey "+tt.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerUpgradeUser(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if upgraded := store.users[userID.String()][5] == true; upgraded != tt.wantUpgraded {
+				t.Errorf("upgraded = %v, want %v", upgraded, tt.wantUpgraded)
+			}
+		})
+	}
+}
+
+func TestCheckReplay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		wantErr   error
+	}{
+		{
+			name:      "Fresh request",
+			timestamp: strconv.FormatInt(now.Unix(), 10),
+			nonce:     "fresh",
+		},
+		{
+			name:      "Stale timestamp",
+			timestamp: strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10),
+			nonce:     "stale",
+			wantErr:   errStaleWebhook,
+		},
+		{
+			name:      "Future timestamp",
+			timestamp: strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10),
+			nonce:     "future",
+			wantErr:   errStaleWebhook,
+		},
+		{
+			name:    "Missing timestamp",
+			nonce:   "untimed",
+			wantErr: errStaleWebhook,
+		},
+		{
+			name:      "Missing nonce",
+			timestamp: strconv.FormatInt(now.Unix(), 10),
+			wantErr:   errMissingNonce,
+		},
+		{
+			name:      "Replayed nonce",
+			timestamp: strconv.FormatInt(now.Unix(), 10),
+			nonce:     "used",
+			wantErr:   errReplayedWebhook,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := newNonceStore(5 * time.Minute)
+			ns.seen["used"] = now.Add(-time.Minute)
+			headers := http.Header{}
+			headers.Set("X-Webhook-Timestamp", tt.timestamp)
+			headers.Set("X-Webhook-Nonce", tt.nonce)
+			if err := ns.checkReplay(headers); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkReplay() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if err := ns.checkReplay(headers); !errors.Is(err, errReplayedWebhook) {
+					t.Errorf("second checkReplay() error = %v, want %v", err, errReplayedWebhook)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReplayForgetsOldNonces(t *testing.T) {
+	ns := newNonceStore(5 * time.Minute)
+	ns.seen["old"] = time.Now().Add(-11 * time.Minute)
+	headers := http.Header{}
+	headers.Set("X-Webhook-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	headers.Set("X-Webhook-Nonce", "new")
+	if err := ns.checkReplay(headers); err != nil {
+		t.Fatalf("checkReplay() error = %v", err)
+	}
+	if _, ok := ns.seen["old"]; ok {
+		t.Errorf("nonce seen %v ago is still remembered", 11*time.Minute)
+	}
+}
+
+func TestUpgradeUserRetryAfterFailure(t *testing.T) {
+	cfg, store := newChirpStoreConfig(t)
+	cfg.polka_key = "polka"
+	cfg.webhookNonces = newNonceStore(5 * time.Minute)
+	userID := store.seedUser("user@example.com")
+
+	body := `{"event":"user.upgraded","data":{"user_id":"` + userID.String() + `"}}`
+	ts, nonce := strconv.FormatInt(time.Now().Unix(), 10), "nonce-1"
+	deliver := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(body))
+		req.Header.Set("X-Webhook-Timestamp", ts)
+		req.Header.Set("X-Webhook-Nonce", nonce)
+		req.Header.Set("X-Polka-Signature", signWebhook(ts, nonce, []byte(body), "polka"))
+		rec := httptest.NewRecorder()
+		cfg.handlerUpgradeUser(rec, req)
+		return rec.Code
+	}
+
+	store.failQuery = "UpgradeUser"
+	if code := deliver(); code != http.StatusInternalServerError {
+		t.Fatalf("first delivery status = %d, want %d", code, http.StatusInternalServerError)
+	}
+	store.failQuery = ""
+	if code := deliver(); code != http.StatusNoContent {
+		t.Fatalf("retry status = %d, want %d", code, http.StatusNoContent)
+	}
+	if store.users[userID.String()][5] != true {
+		t.Errorf("user wasn't upgraded by the retry")
+	}
+	if code := deliver(); code != http.StatusConflict {
+		t.Errorf("replay after success status = %d, want %d", code, http.StatusConflict)
+	}
+}